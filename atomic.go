@@ -0,0 +1,132 @@
+package convertcontent2utf8
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// writeOutput 按配置写入输出文件，并保留源文件元数据
+// write负责产生文件内容；check不为nil时在写入完成后检查输出，原子写入时检查失败则丢弃临时文件
+// 原子写入时在重命名前最后检查一次上下文，结束则丢弃临时文件
+func writeOutput(ctx context.Context, config *Config, path string, write func(io.Writer) error, check func(name string) error, meta *fileMetadata) (*MetadataResult, error) {
+	var outcome *MetadataResult
+	preserve := func(name string) error {
+		if check != nil {
+			if err := check(name); err != nil {
+				return err
+			}
+		}
+		outcome = meta.apply(config, name)
+		return ctx.Err()
+	}
+
+	if !config.AtomicWrite {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := writeFile(path, meta.perm(config), write); err != nil {
+			return nil, err
+		}
+		if check != nil {
+			if err := check(path); err != nil {
+				return nil, err
+			}
+		}
+		outcome = meta.apply(config, path)
+		return outcome, nil
+	}
+
+	if err := writeFileAtomic(path, meta.perm(config), write, preserve); err != nil {
+		return nil, err
+	}
+	return outcome, nil
+}
+
+// writeFileAtomic 原子写入文件：在目标目录写临时文件并同步，再重命名覆盖目标
+// prepare在重命名前对临时文件调用，用于设置元数据，返回错误时放弃写入
+// 任一步骤失败都会删除临时文件，目标文件保持原样
+func writeFileAtomic(path string, perm os.FileMode, write func(io.Writer) error, prepare func(name string) error) (err error) {
+	dir := filepath.Dir(path)
+
+	// 临时文件以点开头，目录遍历跳过隐藏文件时不会被误处理
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("failed to set temp file mode: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if prepare != nil {
+		if err = prepare(tmpName); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+
+	// 同步目录，确保重命名本身落盘
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+// writeFile 直接写入目标文件，不保证写入中途失败时目标文件完整
+func writeFile(path string, perm os.FileMode, write func(io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeBytes 返回写入固定内容的写入函数
+func writeBytes(data []byte) func(io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}
+}
+
+// syncDir 同步目录元数据，Windows不支持对目录调用Sync，直接跳过
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,87 @@
+package convertcontent2utf8
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Run("写入并替换", func(t *testing.T) {
+		testDir := t.TempDir()
+		file := filepath.Join(testDir, "atomic.txt")
+		if err := os.WriteFile(file, []byte("old"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		if err := writeFileAtomic(file, 0640, writeBytes([]byte("new content")), nil); err != nil {
+			t.Fatalf("writeFileAtomic failed: %v", err)
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(data) != "new content" {
+			t.Errorf("Expected new content, got %q", string(data))
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Failed to stat file: %v", err)
+		}
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("Expected mode 0640, got %v", info.Mode().Perm())
+		}
+
+		assertNoTempFiles(t, testDir)
+	})
+
+	t.Run("失败时清理临时文件", func(t *testing.T) {
+		testDir := t.TempDir()
+
+		// 目标是目录，重命名会失败
+		target := filepath.Join(testDir, "target")
+		if err := os.MkdirAll(filepath.Join(target, "child"), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		if err := writeFileAtomic(target, 0644, writeBytes([]byte("data")), nil); err == nil {
+			t.Fatal("Expected error when target is a non-empty directory")
+		}
+
+		assertNoTempFiles(t, testDir)
+	})
+
+	t.Run("关闭原子写入", func(t *testing.T) {
+		testDir := t.TempDir()
+		input := filepath.Join(testDir, "input.txt")
+		output := filepath.Join(testDir, "output.txt")
+		if err := os.WriteFile(input, []byte(gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		if _, err := ConvertFile(input, output, WithAtomicWrite(false)); err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if _, err := os.Stat(output); err != nil {
+			t.Errorf("Output file was not created: %v", err)
+		}
+	})
+}
+
+// assertNoTempFiles 确认目录中没有残留的临时文件
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("Temp file left behind: %s", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package convertcontent2utf8
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupManager 负责在覆盖文件前创建备份
+type backupManager struct {
+	config *Config
+	root   string // 计算备份相对路径的根目录，为空时使用绝对路径
+	stamp  string // 本次运行的归档时间戳
+}
+
+// newBackupManager 创建备份管理器，同一次运行共享一个归档时间戳
+func newBackupManager(config *Config, root string) *backupManager {
+	return &backupManager{
+		config: config,
+		root:   root,
+		stamp:  time.Now().Format("20060102-150405"),
+	}
+}
+
+// backup 备份即将被覆盖的文件，文件不存在时无需备份并返回空路径
+func (m *backupManager) backup(file string) (string, error) {
+	info, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	backupFile, err := m.backupPath(file)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(backupFile), 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	if err := copyFile(file, backupFile, info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("failed to create backup %s: %w", backupFile, err)
+	}
+
+	return backupFile, nil
+}
+
+// backupPath 根据备份模式生成备份文件路径
+func (m *backupManager) backupPath(file string) (string, error) {
+	suffix := m.config.BackupSuffix
+
+	switch m.config.BackupMode {
+	case BackupMirror:
+		if m.config.BackupDir == "" {
+			return "", fmt.Errorf("backup directory is required for %s mode", BackupMirror)
+		}
+		rel, err := m.relPath(file)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(m.config.BackupDir, rel) + suffix, nil
+	case BackupArchive:
+		if m.config.BackupDir == "" {
+			return "", fmt.Errorf("backup directory is required for %s mode", BackupArchive)
+		}
+		rel, err := m.relPath(file)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(m.config.BackupDir, m.stamp, rel), nil
+	case BackupSibling, "":
+		return file + suffix, nil
+	default:
+		return "", fmt.Errorf("unknown backup mode: %s", m.config.BackupMode)
+	}
+}
+
+// relPath 计算文件在备份目录中的相对路径
+func (m *backupManager) relPath(file string) (string, error) {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+
+	// 文件位于根目录内时保留相对结构
+	if m.root != "" {
+		absRoot, err := filepath.Abs(m.root)
+		if err != nil {
+			return "", err
+		}
+		if rel, err := filepath.Rel(absRoot, absFile); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel, nil
+		}
+	}
+
+	// 否则使用去掉卷名和前导分隔符的绝对路径
+	absFile = strings.TrimPrefix(absFile, filepath.VolumeName(absFile))
+	return strings.TrimLeft(absFile, string(filepath.Separator)), nil
+}
+
+// isBackupPath 判断路径是否位于备份目录内，目录遍历时用于跳过备份
+func (m *backupManager) isBackupPath(path string) bool {
+	if !m.config.CreateBackup || m.config.BackupMode == BackupSibling || m.config.BackupDir == "" {
+		return false
+	}
+
+	absDir, err := filepath.Abs(m.config.BackupDir)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
+
+// RestoreBackup 使用转换结果中记录的备份恢复输出文件
+func RestoreBackup(result *ConvertResult) error {
+	if result == nil {
+		return fmt.Errorf("convert result cannot be nil")
+	}
+	if result.BackupFile == "" {
+		return fmt.Errorf("no backup recorded for %s", result.OutputFile)
+	}
+
+	info, err := os.Stat(result.BackupFile)
+	if err != nil {
+		return fmt.Errorf("backup file is not accessible: %w", err)
+	}
+
+	if err := copyFile(result.BackupFile, result.OutputFile, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to restore %s from %s: %w", result.OutputFile, result.BackupFile, err)
+	}
+
+	return nil
+}
+
+// RestoreBackups 批量恢复，跳过没有备份的结果并返回恢复失败的文件
+func RestoreBackups(batch *BatchResult) []FileError {
+	var fileErrors []FileError
+	if batch == nil {
+		return fileErrors
+	}
+
+	for _, result := range batch.Results {
+		if result == nil || result.BackupFile == "" {
+			continue
+		}
+		if err := RestoreBackup(result); err != nil {
+			fileErrors = append(fileErrors, newFileError(result.OutputFile, OpRestore, err))
+		}
+	}
+
+	return fileErrors
+}
+
+// copyFile 复制文件内容并设置权限
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
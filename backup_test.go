@@ -0,0 +1,176 @@
+package convertcontent2utf8
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	// 非UTF-8内容，原地转换时才会改写并备份
+	original := gbkSample
+
+	t.Run("同目录备份", func(t *testing.T) {
+		testDir := t.TempDir()
+		file := filepath.Join(testDir, "sibling.txt")
+		if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, WithOverwrite(true))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+
+		expected := file + ".bak"
+		if result.BackupFile != expected {
+			t.Errorf("Expected BackupFile %s, got %s", expected, result.BackupFile)
+		}
+		data, err := os.ReadFile(expected)
+		if err != nil {
+			t.Fatalf("Backup file was not created: %v", err)
+		}
+		if string(data) != original {
+			t.Errorf("Backup content mismatch: %q", string(data))
+		}
+	})
+
+	t.Run("输出文件不存在时不备份", func(t *testing.T) {
+		testDir := t.TempDir()
+		input := filepath.Join(testDir, "input.txt")
+		output := filepath.Join(testDir, "output.txt")
+		if err := os.WriteFile(input, []byte(original), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(input, output)
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.BackupFile != "" {
+			t.Errorf("Expected no backup, got %s", result.BackupFile)
+		}
+	})
+
+	t.Run("镜像目录备份", func(t *testing.T) {
+		testDir := t.TempDir()
+		backupDir := filepath.Join(testDir, "backup")
+		subDir := filepath.Join(testDir, "src", "sub")
+		if err := os.MkdirAll(subDir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		file := filepath.Join(subDir, "mirror.txt")
+		if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertDirectory(filepath.Join(testDir, "src"),
+			WithRecursive(true),
+			WithOverwrite(true),
+			WithBackupMode(BackupMirror),
+			WithBackupDir(backupDir),
+		)
+		if err != nil {
+			t.Fatalf("ConvertDirectory failed: %v", err)
+		}
+		if len(result.Results) != 1 {
+			t.Fatalf("Expected 1 result, got %d", len(result.Results))
+		}
+
+		expected := filepath.Join(backupDir, "sub", "mirror.txt.bak")
+		if result.Results[0].BackupFile != expected {
+			t.Errorf("Expected BackupFile %s, got %s", expected, result.Results[0].BackupFile)
+		}
+	})
+
+	t.Run("时间戳归档备份", func(t *testing.T) {
+		testDir := t.TempDir()
+		backupDir := filepath.Join(testDir, "archive")
+		file := filepath.Join(testDir, "archive_test.txt")
+		if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file,
+			WithOverwrite(true),
+			WithBackupMode(BackupArchive),
+			WithBackupDir(backupDir),
+		)
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if !strings.HasPrefix(result.BackupFile, backupDir) {
+			t.Errorf("Expected BackupFile under %s, got %s", backupDir, result.BackupFile)
+		}
+		if !strings.HasSuffix(result.BackupFile, "archive_test.txt") {
+			t.Errorf("Expected BackupFile to keep original name, got %s", result.BackupFile)
+		}
+	})
+
+	t.Run("缺少备份目录", func(t *testing.T) {
+		testDir := t.TempDir()
+		file := filepath.Join(testDir, "no_dir.txt")
+		if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		_, err := ConvertFile(file, file, WithOverwrite(true), WithBackupMode(BackupMirror))
+		if err == nil {
+			t.Error("Expected error when backup directory is missing")
+		}
+	})
+}
+
+func TestRestoreBackup(t *testing.T) {
+	testDir := t.TempDir()
+	file := filepath.Join(testDir, "restore.txt")
+	original := gbkSample
+	if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	batch, err := ConvertFiles([]string{file}, WithOverwrite(true))
+	if err != nil {
+		t.Fatalf("ConvertFiles failed: %v", err)
+	}
+
+	// 模拟转换后文件被改动
+	if err := os.WriteFile(file, []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+
+	if errs := RestoreBackups(batch); len(errs) != 0 {
+		t.Fatalf("RestoreBackups failed: %v", errs)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read restored file: %v", err)
+	}
+	if string(data) != original {
+		t.Errorf("Expected restored content %q, got %q", original, string(data))
+	}
+
+	if err := RestoreBackup(&ConvertResult{OutputFile: file}); err == nil {
+		t.Error("Expected error when no backup is recorded")
+	}
+
+	// 备份已被删除时返回可用errors.Is/As判断的文件错误
+	if err := os.Remove(batch.Results[0].BackupFile); err != nil {
+		t.Fatalf("Failed to remove backup: %v", err)
+	}
+	errs := RestoreBackups(batch)
+	if len(errs) != 1 || errs[0].Operation != OpRestore {
+		t.Fatalf("Expected 1 restore error, got %+v", errs)
+	}
+	var convertErr *ConvertError
+	if !errors.As(errs[0].Err, &convertErr) || convertErr.Op != OpRestore {
+		t.Errorf("Expected *ConvertError with Op %s, got %v", OpRestore, errs[0].Err)
+	}
+	if !errors.Is(errs[0].Err, fs.ErrNotExist) {
+		t.Errorf("Expected fs.ErrNotExist, got %v", errs[0].Err)
+	}
+}
@@ -0,0 +1,146 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// binarySniffSize 判断二进制文件时检查的前缀大小
+const binarySniffSize = detectionSampleSize
+
+// maxControlRatio 控制字符占比超过该值即视为二进制
+const maxControlRatio = 0.1
+
+// binarySignature 已知二进制格式的文件头
+type binarySignature struct {
+	name   string
+	offset int
+	magic  []byte
+}
+
+// binarySignatures 常见的压缩包、文档、图片、可执行文件和数据库格式
+// 太短、可能作为正文开头的文件头（如"MZ"）不列入，这类文件通常含NUL字节，由NUL检查识别
+var binarySignatures = []binarySignature{
+	{"gzip", 0, []byte{0x1f, 0x8b}},
+	{"zip", 0, []byte("PK\x03\x04")},
+	{"pdf", 0, []byte("%PDF-")},
+	{"png", 0, []byte("\x89PNG\r\n\x1a\n")},
+	{"jpeg", 0, []byte{0xff, 0xd8, 0xff}},
+	{"gif", 0, []byte("GIF8")},
+	{"elf", 0, []byte("\x7fELF")},
+	{"bzip2", 0, []byte("BZh")},
+	{"xz", 0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"zstd", 0, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{"7z", 0, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},
+	{"rar", 0, []byte("Rar!\x1a\x07")},
+	{"ole", 0, []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}},
+	{"sqlite", 0, []byte("SQLite format 3\x00")},
+	{"wasm", 0, []byte("\x00asm")},
+	{"java class", 0, []byte{0xca, 0xfe, 0xba, 0xbe}},
+	{"mach-o", 0, []byte{0xcf, 0xfa, 0xed, 0xfe}},
+	{"mach-o", 0, []byte{0xce, 0xfa, 0xed, 0xfe}},
+	{"webp", 8, []byte("WEBP")},
+	{"tar", 257, []byte("ustar")},
+}
+
+// sniffBinary 根据文件头、NUL字节和控制字符占比判断数据是否为二进制，返回判断依据
+func sniffBinary(sample []byte) (bool, string) {
+	for _, sig := range binarySignatures {
+		end := sig.offset + len(sig.magic)
+		if len(sample) >= end && bytes.Equal(sample[sig.offset:end], sig.magic) {
+			return true, sig.name + " signature"
+		}
+	}
+	if len(sample) == 0 {
+		return false, ""
+	}
+
+	// 带BOM的UTF-16/32文本会含有NUL字节，不按NUL和控制字符判断
+	bom := sniffBOM(sample)
+	unicodeText := bom != BOMNone && bom != BOMUTF8
+
+	if !unicodeText && bytes.IndexByte(sample, 0) >= 0 {
+		if !looksLikeUTF16(sample) {
+			return true, "contains NUL bytes"
+		}
+		unicodeText = true
+	}
+
+	if !unicodeText {
+		control := 0
+		for _, b := range sample {
+			if isBinaryControl(b) {
+				control++
+			}
+		}
+		if ratio := float64(control) / float64(len(sample)); ratio > maxControlRatio {
+			return true, fmt.Sprintf("%.0f%% control characters", ratio*100)
+		}
+	}
+	return false, ""
+}
+
+// looksLikeUTF16 判断无BOM的数据是否像UTF-16文本：NUL字节全部位于同一奇偶位置，且占该位置的多数
+func looksLikeUTF16(sample []byte) bool {
+	var even, odd int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			even++
+		} else {
+			odd++
+		}
+	}
+	half := len(sample) / 2
+	if half == 0 {
+		return false
+	}
+	return (odd == 0 && even*2 > half) || (even == 0 && odd*2 > half)
+}
+
+// isBinaryControl 判断字节是否为文本中不常见的控制字符，制表、换行、换页、退格和ESC除外
+func isBinaryControl(b byte) bool {
+	switch b {
+	case '\t', '\n', '\v', '\f', '\r', '\b', 0x1b:
+		return false
+	}
+	return b < 0x20 || b == 0x7f
+}
+
+// checkBinary 未设置IncludeBinary时检查数据前缀，二进制时返回ErrBinaryFile
+func checkBinary(config *Config, sample []byte) error {
+	if config.IncludeBinary {
+		return nil
+	}
+	if len(sample) > binarySniffSize {
+		sample = sample[:binarySniffSize]
+	}
+	if binary, reason := sniffBinary(sample); binary {
+		return fmt.Errorf("%w: %s", ErrBinaryFile, reason)
+	}
+	return nil
+}
+
+// checkBinaryFile 读取文件前缀检查是否为二进制
+func checkBinaryFile(config *Config, path string) error {
+	if config.IncludeBinary {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sample := make([]byte, binarySniffSize)
+	n, err := io.ReadFull(f, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	return checkBinary(config, sample[:n])
+}
@@ -0,0 +1,151 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSniffBinary(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected bool
+	}{
+		{"gzip文件头", []byte{0x1f, 0x8b, 0x08, 0x00, 'a', 'b'}, true},
+		{"PDF文件头", []byte("%PDF-1.7\nhello"), true},
+		{"tar文件头", append(make([]byte, 257), "ustar\x0000"...), true},
+		{"含NUL字节", []byte("hello\x00world\x00\x01\x02"), true},
+		{"控制字符过多", bytes.Repeat([]byte("ab\x01\x02\x03"), 100), true},
+		{"带BOM的UTF-16LE", []byte("\xff\xfeh\x00i\x00\n\x00"), false},
+		{"无BOM的UTF-16LE", []byte("h\x00e\x00l\x00l\x00o\x00"), false},
+		{"GBK文本", []byte(gbkSample), false},
+		{"ASCII文本", []byte("package main\n\nfunc main() {\n\tprintln(\"\\x1b[0m\")\n}\n"), false},
+		{"空数据", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binary, reason := sniffBinary(tt.data)
+			if binary != tt.expected {
+				t.Errorf("Expected binary=%v, got %v (%s)", tt.expected, binary, reason)
+			}
+		})
+	}
+}
+
+func TestBinaryFiles(t *testing.T) {
+	gzipData := []byte{0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0xcb, 0x48, 0xcd, 0xc9, 0xc9}
+
+	t.Run("批量跳过二进制文件", func(t *testing.T) {
+		tempDir := t.TempDir()
+		binaryFile := filepath.Join(tempDir, "data.txt")
+		textFile := filepath.Join(tempDir, "text.txt")
+		if err := os.WriteFile(binaryFile, gzipData, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if err := os.WriteFile(textFile, []byte(gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		var statuses []ProgressStatus
+		result, err := ConvertDirectory(tempDir, WithOverwrite(true), WithBackup(false), WithConcurrency(1), WithProgress(func(p Progress) {
+			if p.CurrentFile == binaryFile {
+				statuses = append(statuses, p.Status)
+			}
+		}))
+		if err != nil {
+			t.Fatalf("ConvertDirectory failed: %v", err)
+		}
+		if result.SkippedFiles != 1 || result.FailedFiles != 0 || result.SuccessfulFiles != 1 {
+			t.Errorf("Expected 1 skipped, 0 failed, 1 success, got %d, %d, %d",
+				result.SkippedFiles, result.FailedFiles, result.SuccessfulFiles)
+		}
+		if len(result.Errors) != 1 || !errors.Is(result.Errors[0].Err, ErrBinaryFile) {
+			t.Fatalf("Expected ErrBinaryFile, got %+v", result.Errors)
+		}
+		if result.Errors[0].Operation != OpBinary {
+			t.Errorf("Expected operation %s, got %s", OpBinary, result.Errors[0].Operation)
+		}
+		if len(statuses) == 0 || statuses[len(statuses)-1] != StatusBinary {
+			t.Errorf("Expected final status %s, got %v", StatusBinary, statuses)
+		}
+
+		content, _ := os.ReadFile(binaryFile)
+		if !bytes.Equal(content, gzipData) {
+			t.Error("Binary file should be left untouched")
+		}
+	})
+
+	t.Run("事务模式不因二进制文件回滚", func(t *testing.T) {
+		tempDir := t.TempDir()
+		textFile := filepath.Join(tempDir, "text.txt")
+		if err := os.WriteFile(filepath.Join(tempDir, "data.txt"), gzipData, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if err := os.WriteFile(textFile, []byte(gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertDirectory(tempDir, WithOverwrite(true), WithBackup(false), WithTransaction(true))
+		if err != nil {
+			t.Fatalf("ConvertDirectory failed: %v", err)
+		}
+		if !result.Committed {
+			t.Errorf("Expected transaction to be committed, errors: %+v", result.Errors)
+		}
+		content, _ := os.ReadFile(textFile)
+		if string(content) != gbkSampleText {
+			t.Errorf("Expected converted text, got %q", string(content))
+		}
+	})
+
+	t.Run("强制处理二进制文件", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "data.txt")
+		data := append([]byte("%PDF-1.4\n"), gbkSample...)
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		if _, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false)); !errors.Is(err, ErrBinaryFile) {
+			t.Fatalf("Expected ErrBinaryFile, got %v", err)
+		}
+
+		_, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithIncludeBinary(true), WithMinConfidence(0))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		content, _ := os.ReadFile(file)
+		if !strings.HasPrefix(string(content), "%PDF-1.4\n") || bytes.Equal(content, data) {
+			t.Errorf("Expected file to be converted, got %q", string(content))
+		}
+	})
+
+	t.Run("内存和流式转换", func(t *testing.T) {
+		if _, _, err := ConvertBytes(gzipData); !errors.Is(err, ErrBinaryFile) {
+			t.Errorf("Expected ErrBinaryFile from ConvertBytes, got %v", err)
+		}
+
+		var out bytes.Buffer
+		_, err := ConvertReader(context.Background(), bytes.NewReader(gzipData), &out)
+		var convertErr *ConvertError
+		if !errors.As(err, &convertErr) || convertErr.Op != OpBinary {
+			t.Errorf("Expected *ConvertError with Op %s, got %v", OpBinary, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("Expected no output, got %d bytes", out.Len())
+		}
+
+		var text bytes.Buffer
+		if _, err := ConvertReader(context.Background(), strings.NewReader(gbkSample), &text); err != nil {
+			t.Fatalf("ConvertReader failed: %v", err)
+		}
+		if text.String() != gbkSampleText {
+			t.Errorf("Expected %q, got %q", gbkSampleText, text.String())
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	encoding "github.com/mirbf/encoding-processor"
+)
+
+// BOMPolicy 输出文件的字节顺序标记（BOM）策略，只对UTF-8/16/32目标编码生效
+type BOMPolicy string
+
+const (
+	BOMKeep           BOMPolicy = "keep"      // 输入带BOM时输出也带，BOM换成目标编码的形式
+	BOMStrip          BOMPolicy = "strip"     // 输出不带BOM
+	BOMAdd            BOMPolicy = "add"       // 输出总是带BOM
+	BOMAddByExtension BOMPolicy = "extension" // 扩展名在BOMExtensions中的文件带BOM，其他文件不带
+)
+
+// BOM 字节顺序标记的类型，值为对应的编码名称，没有BOM时为空
+type BOM string
+
+const (
+	BOMNone    BOM = ""
+	BOMUTF8    BOM = BOM(encoding.EncodingUTF8)
+	BOMUTF16LE BOM = BOM(encoding.EncodingUTF16LE)
+	BOMUTF16BE BOM = BOM(encoding.EncodingUTF16BE)
+	BOMUTF32LE BOM = BOM(encoding.EncodingUTF32LE)
+	BOMUTF32BE BOM = BOM(encoding.EncodingUTF32BE)
+)
+
+// boms 各BOM的字节序列，UTF-32LE排在UTF-16LE之前，避免被当作UTF-16LE的BOM
+var boms = []struct {
+	bom   BOM
+	bytes []byte
+}{
+	{BOMUTF8, []byte{0xef, 0xbb, 0xbf}},
+	{BOMUTF32LE, []byte{0xff, 0xfe, 0x00, 0x00}},
+	{BOMUTF32BE, []byte{0x00, 0x00, 0xfe, 0xff}},
+	{BOMUTF16LE, []byte{0xff, 0xfe}},
+	{BOMUTF16BE, []byte{0xfe, 0xff}},
+}
+
+// maxBOMLen BOM的最大长度
+const maxBOMLen = 4
+
+// sniffBOM 识别数据开头的BOM
+func sniffBOM(data []byte) BOM {
+	for _, b := range boms {
+		if bytes.HasPrefix(data, b.bytes) {
+			return b.bom
+		}
+	}
+	return BOMNone
+}
+
+// Bytes 返回BOM的字节序列副本，BOMNone时为nil
+func (b BOM) Bytes() []byte {
+	for _, known := range boms {
+		if known.bom == b {
+			return bytes.Clone(known.bytes)
+		}
+	}
+	return nil
+}
+
+// detection 由BOM确定的源编码，BOM比统计检测更可靠
+func (b BOM) detection() *encoding.DetectionResult {
+	return &encoding.DetectionResult{Encoding: string(b), Confidence: 1.0}
+}
+
+// encodingBOM 返回目标编码对应的BOM，未标明字节序的UTF-16/32按大端，非Unicode编码返回BOMNone
+func encodingBOM(name string) BOM {
+	switch strings.ToUpper(name) {
+	case encoding.EncodingUTF8, "UTF8":
+		return BOMUTF8
+	case encoding.EncodingUTF16, encoding.EncodingUTF16BE:
+		return BOMUTF16BE
+	case encoding.EncodingUTF16LE:
+		return BOMUTF16LE
+	case encoding.EncodingUTF32, encoding.EncodingUTF32BE:
+		return BOMUTF32BE
+	case encoding.EncodingUTF32LE:
+		return BOMUTF32LE
+	}
+	return BOMNone
+}
+
+// outputBOM 按策略决定写入path的输出带哪种BOM，input为输入的BOM；目标编码不是Unicode编码时不带BOM
+func (c *Config) outputBOM(path string, input BOM) (BOM, error) {
+	switch c.BOMPolicy {
+	case BOMKeep, "":
+		if input == BOMNone {
+			return BOMNone, nil
+		}
+	case BOMStrip:
+		return BOMNone, nil
+	case BOMAdd:
+	case BOMAddByExtension:
+		if !c.bomExtension(path) {
+			return BOMNone, nil
+		}
+	default:
+		return BOMNone, fmt.Errorf("unknown BOM policy: %s", c.BOMPolicy)
+	}
+	return encodingBOM(c.TargetEncoding), nil
+}
+
+// bomExtension 判断path的扩展名是否在BOMExtensions中，不区分大小写，扩展名可省略开头的点
+func (c *Config) bomExtension(path string) bool {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if ext == "" {
+		return false
+	}
+	for _, e := range c.BOMExtensions {
+		if strings.EqualFold(strings.TrimPrefix(e, "."), ext) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSniffBOM(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected BOM
+	}{
+		{"UTF-8", []byte("\xef\xbb\xbfabc"), BOMUTF8},
+		{"UTF-16LE", []byte("\xff\xfea\x00"), BOMUTF16LE},
+		{"UTF-16BE", []byte("\xfe\xff\x00a"), BOMUTF16BE},
+		{"UTF-32LE优先于UTF-16LE", []byte("\xff\xfe\x00\x00a\x00\x00\x00"), BOMUTF32LE},
+		{"UTF-32BE", []byte("\x00\x00\xfe\xff\x00\x00\x00a"), BOMUTF32BE},
+		{"无BOM", []byte("abc"), BOMNone},
+		{"不完整的BOM", []byte("\xef\xbb"), BOMNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if bom := sniffBOM(tt.data); bom != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, bom)
+			}
+		})
+	}
+}
+
+func TestBOMPolicy(t *testing.T) {
+	utf8BOM := "\xef\xbb\xbf"
+
+	tests := []struct {
+		name      string
+		input     string
+		options   []Option
+		expected  string
+		inputBOM  BOM
+		outputBOM BOM
+	}{
+		{"保留UTF-8 BOM", utf8BOM + gbkSampleText, nil, utf8BOM + gbkSampleText, BOMUTF8, BOMUTF8},
+		{"去掉UTF-8 BOM", utf8BOM + gbkSampleText, []Option{WithBOMPolicy(BOMStrip)}, gbkSampleText, BOMUTF8, BOMNone},
+		{"添加BOM", gbkSample, []Option{WithBOMPolicy(BOMAdd)}, utf8BOM + gbkSampleText, BOMNone, BOMUTF8},
+		{"无BOM时保留为无", gbkSample, nil, gbkSampleText, BOMNone, BOMNone},
+		{"UTF-16LE的BOM换成UTF-8形式", "\xff\xfeh\x00i\x00", nil, utf8BOM + "hi", BOMUTF16LE, BOMUTF8},
+		{"目标为UTF-16LE", "hi", []Option{WithTargetEncoding("UTF-16LE"), WithBOMPolicy(BOMAdd)}, "\xff\xfeh\x00i\x00", BOMNone, BOMUTF16LE},
+		{"目标为UTF-16默认大端", "hi", []Option{WithTargetEncoding("UTF-16"), WithBOMPolicy(BOMAdd)}, "\xfe\xff\x00h\x00i", BOMNone, BOMUTF16BE},
+		{"非Unicode目标编码不带BOM", utf8BOM + gbkSampleText, []Option{WithTargetEncoding("GBK")}, gbkSample, BOMUTF8, BOMNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := append([]Option{WithMinConfidence(0)}, tt.options...)
+			converted, result, err := ConvertBytes([]byte(tt.input), options...)
+			if err != nil {
+				t.Fatalf("ConvertBytes failed: %v", err)
+			}
+			if string(converted) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(converted))
+			}
+			if result.InputBOM != tt.inputBOM || result.OutputBOM != tt.outputBOM {
+				t.Errorf("Expected BOM %q -> %q, got %q -> %q", tt.inputBOM, tt.outputBOM, result.InputBOM, result.OutputBOM)
+			}
+		})
+	}
+
+	t.Run("未知策略", func(t *testing.T) {
+		if _, _, err := ConvertBytes([]byte(gbkSample), WithBOMPolicy("sometimes")); err == nil {
+			t.Error("Expected error for unknown BOM policy")
+		}
+	})
+
+	t.Run("按扩展名添加", func(t *testing.T) {
+		tempDir := t.TempDir()
+		csvFile := filepath.Join(tempDir, "data.CSV")
+		txtFile := filepath.Join(tempDir, "notes.txt")
+		for _, file := range []string{csvFile, txtFile} {
+			if err := os.WriteFile(file, []byte(utf8BOM+gbkSampleText), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+
+		_, err := ConvertDirectory(tempDir,
+			WithOverwrite(true),
+			WithBackup(false),
+			WithBOMExtensions("csv"),
+			WithFileFilter(func(string) bool { return true }),
+		)
+		if err != nil {
+			t.Fatalf("ConvertDirectory failed: %v", err)
+		}
+
+		content, _ := os.ReadFile(csvFile)
+		if string(content) != utf8BOM+gbkSampleText {
+			t.Errorf("Expected CSV file to keep BOM, got %q", string(content))
+		}
+		content, _ = os.ReadFile(txtFile)
+		if string(content) != gbkSampleText {
+			t.Errorf("Expected text file without BOM, got %q", string(content))
+		}
+	})
+
+	t.Run("已是UTF-8但需去掉BOM时改写", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "bom.txt")
+		if err := os.WriteFile(file, []byte(utf8BOM+"hello"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputUnchanged || result.InputBOM != BOMUTF8 {
+			t.Errorf("Expected unchanged file with UTF-8 BOM, got %s, %q", result.OutputAction, result.InputBOM)
+		}
+
+		result, err = ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithBOMPolicy(BOMStrip), WithVerify(true))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputOverwritten || result.Verification != VerifyPassed {
+			t.Errorf("Expected verified overwrite, got %s, %s", result.OutputAction, result.Verification)
+		}
+		content, _ := os.ReadFile(file)
+		if string(content) != "hello" {
+			t.Errorf("Expected BOM to be stripped, got %q", string(content))
+		}
+	})
+
+	t.Run("流式转换", func(t *testing.T) {
+		input := "\xff\xfe" + strings.Repeat("h\x00i\x00", 5000)
+		file := filepath.Join(t.TempDir(), "utf16.txt")
+		if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithStreamThreshold(1), WithBOMPolicy(BOMStrip))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		content, _ := os.ReadFile(file)
+		if string(content) != strings.Repeat("hi", 5000) {
+			t.Errorf("Expected BOM-less UTF-8 output, got %q...", string(content[:10]))
+		}
+		if result.InputBOM != BOMUTF16LE || result.OutputBOM != BOMNone {
+			t.Errorf("Expected BOM UTF-16LE -> none, got %q -> %q", result.InputBOM, result.OutputBOM)
+		}
+		if result.BytesProcessed != int64(len(input)) {
+			t.Errorf("Expected BytesProcessed %d, got %d", len(input), result.BytesProcessed)
+		}
+
+		var out bytes.Buffer
+		result, err = ConvertReader(context.Background(), strings.NewReader(input), &out, WithBOMPolicy(BOMAdd))
+		if err != nil {
+			t.Fatalf("ConvertReader failed: %v", err)
+		}
+		if !strings.HasPrefix(out.String(), utf8BOM+"hihi") || result.OutputBytes != int64(out.Len()) {
+			t.Errorf("Expected UTF-8 BOM and %d output bytes, got %q..., %d", out.Len(), out.String()[:7], result.OutputBytes)
+		}
+	})
+}
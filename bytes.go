@@ -0,0 +1,42 @@
+package convertcontent2utf8
+
+import (
+	"time"
+)
+
+// ConvertBytes 转换内存中的数据，检测、置信度和错误语义与文件接口一致，不访问文件系统
+// 返回的结果中InputFile和OutputFile为空
+func ConvertBytes(data []byte, options ...Option) ([]byte, *ConvertResult, error) {
+	return NewConverter(options...).ConvertBytes(data)
+}
+
+// ConvertString 转换字符串，语义与ConvertBytes相同
+func ConvertString(s string, options ...Option) (string, *ConvertResult, error) {
+	return NewConverter(options...).ConvertString(s)
+}
+
+// ConvertBytes 转换内存中的数据，不访问文件系统
+func (c *Converter) ConvertBytes(data []byte) ([]byte, *ConvertResult, error) {
+	config := c.config
+	start := time.Now()
+
+	if err := checkBinary(config, data); err != nil {
+		return nil, nil, newConvertError("", OpBinary, err)
+	}
+
+	converted, result, operation, err := convertData(config, c.processor, data, "", "")
+	if err != nil {
+		return nil, nil, newConvertError("", operation, err)
+	}
+	result.ProcessingTime = time.Since(start)
+	return converted, result, nil
+}
+
+// ConvertString 转换字符串
+func (c *Converter) ConvertString(s string) (string, *ConvertResult, error) {
+	converted, result, err := c.ConvertBytes([]byte(s))
+	if err != nil {
+		return "", nil, err
+	}
+	return string(converted), result, nil
+}
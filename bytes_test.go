@@ -0,0 +1,58 @@
+package convertcontent2utf8
+
+import (
+	"testing"
+)
+
+func TestConvertBytes(t *testing.T) {
+	t.Run("GBK转UTF-8", func(t *testing.T) {
+		converted, result, err := ConvertBytes([]byte(gbkSample))
+		if err != nil {
+			t.Fatalf("ConvertBytes failed: %v", err)
+		}
+		if string(converted) != gbkSampleText {
+			t.Errorf("Expected %q, got %q", gbkSampleText, string(converted))
+		}
+		if !result.Changed {
+			t.Error("Expected Changed to be true")
+		}
+		if result.BytesProcessed != int64(len(gbkSample)) {
+			t.Errorf("Expected BytesProcessed %d, got %d", len(gbkSample), result.BytesProcessed)
+		}
+		if result.InputFile != "" || result.OutputFile != "" {
+			t.Errorf("Expected no file paths, got %q and %q", result.InputFile, result.OutputFile)
+		}
+	})
+
+	t.Run("UTF-8字符串不变", func(t *testing.T) {
+		converted, result, err := ConvertString(gbkSampleText)
+		if err != nil {
+			t.Fatalf("ConvertString failed: %v", err)
+		}
+		if converted != gbkSampleText {
+			t.Errorf("Expected %q, got %q", gbkSampleText, converted)
+		}
+		if result.Changed {
+			t.Error("Expected Changed to be false")
+		}
+	})
+
+	t.Run("空数据", func(t *testing.T) {
+		converted, result, err := ConvertBytes(nil)
+		if err != nil {
+			t.Fatalf("ConvertBytes failed: %v", err)
+		}
+		if len(converted) != 0 {
+			t.Errorf("Expected empty output, got %q", converted)
+		}
+		if result.SourceEncoding != "UTF-8" {
+			t.Errorf("Expected UTF-8, got %s", result.SourceEncoding)
+		}
+	})
+
+	t.Run("低置信度", func(t *testing.T) {
+		if _, _, err := ConvertBytes([]byte(gbkSample), WithMinConfidence(1.01)); err == nil {
+			t.Error("Expected error for low confidence")
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package convertcontent2utf8
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	encoding "github.com/mirbf/encoding-processor"
+	textencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+// lookupEncoding 根据encoding-processor的编码名称获取x/text编码实现，用于流式转码
+// BOM由转换流程单独识别和写入，UTF-16/32编解码器不处理BOM，未标明字节序时按大端
+func lookupEncoding(name string) (textencoding.Encoding, error) {
+	switch strings.ToUpper(name) {
+	case encoding.EncodingUTF8, "ASCII":
+		return unicode.UTF8, nil
+	case encoding.EncodingUTF16:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), nil
+	case encoding.EncodingUTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), nil
+	case encoding.EncodingUTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), nil
+	case encoding.EncodingUTF32:
+		return utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM), nil
+	case encoding.EncodingUTF32LE:
+		return utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM), nil
+	case encoding.EncodingUTF32BE:
+		return utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM), nil
+	case encoding.EncodingGBK, encoding.EncodingGB2312, "EUC-CN":
+		return simplifiedchinese.GBK, nil
+	case encoding.EncodingGB18030:
+		return simplifiedchinese.GB18030, nil
+	case "HZ":
+		return simplifiedchinese.HZGB2312, nil
+	case encoding.EncodingBIG5:
+		return traditionalchinese.Big5, nil
+	case encoding.EncodingShiftJIS:
+		return japanese.ShiftJIS, nil
+	case encoding.EncodingEUCJP:
+		return japanese.EUCJP, nil
+	case encoding.EncodingEUCKR:
+		return korean.EUCKR, nil
+	case encoding.EncodingISO88591:
+		return charmap.ISO8859_1, nil
+	case encoding.EncodingISO88592:
+		return charmap.ISO8859_2, nil
+	case encoding.EncodingISO88595:
+		return charmap.ISO8859_5, nil
+	case encoding.EncodingISO885915:
+		return charmap.ISO8859_15, nil
+	case encoding.EncodingWindows1250:
+		return charmap.Windows1250, nil
+	case encoding.EncodingWindows1251:
+		return charmap.Windows1251, nil
+	case encoding.EncodingWindows1252:
+		return charmap.Windows1252, nil
+	case encoding.EncodingWindows1254:
+		return charmap.Windows1254, nil
+	case encoding.EncodingKOI8R:
+		return charmap.KOI8R, nil
+	case encoding.EncodingCP866:
+		return charmap.CodePage866, nil
+	case encoding.EncodingMacintosh:
+		return charmap.Macintosh, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, name)
+	}
+}
+
+// isUTF8Name 判断编码名称是否为UTF-8（含其ASCII子集）
+func isUTF8Name(name string) bool {
+	switch strings.ToUpper(name) {
+	case encoding.EncodingUTF8, "UTF8", "ASCII":
+		return true
+	}
+	return false
+}
+
+// invalidUTF8 返回data中第一个非法UTF-8序列的偏移，全部合法时返回-1
+func invalidUTF8(data []byte) int {
+	if utf8.Valid(data) {
+		return -1
+	}
+	for i := 0; i < len(data); {
+		if data[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+// trimIncompleteUTF8 去掉样本末尾被截断的UTF-8多字节序列，避免截断导致误判
+func trimIncompleteUTF8(sample []byte) []byte {
+	// 从末尾向前最多回看utf8.UTFMax-1个字节寻找序列起始字节
+	for i := 1; i < utf8.UTFMax && i <= len(sample); i++ {
+		b := sample[len(sample)-i]
+		if b < utf8.RuneSelf {
+			return sample
+		}
+		if utf8.RuneStart(b) {
+			if !utf8.FullRune(sample[len(sample)-i:]) {
+				return sample[:len(sample)-i]
+			}
+			return sample
+		}
+	}
+	return sample
+}
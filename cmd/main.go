@@ -1,16 +1,29 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
 
 	converter "github.com/mirbf/ConvertContent2UTF8"
 )
 
 func main() {
+	// 子命令
+	if len(os.Args) > 1 && os.Args[1] == "manifest" {
+		runManifest(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "undo" {
+		runUndo(os.Args[2:])
+		return
+	}
+
 	var (
 		inputPath    = flag.String("input", "", "输入文件或目录路径")
 		outputPath   = flag.String("output", "", "输出路径（可选，默认覆盖原文件）")
@@ -20,12 +33,34 @@ func main() {
 		verbose      = flag.Bool("verbose", false, "显示详细信息")
 		concurrent   = flag.Int("concurrent", 10, "并发处理数量")
 		confidence   = flag.Float64("confidence", 0.8, "编码检测置信度阈值")
+		keepTimes    = flag.Bool("preserve-times", false, "保留文件访问和修改时间")
+		keepOwner    = flag.Bool("preserve-owner", false, "保留文件属主和属组（需要相应权限）")
+		keepXattrs   = flag.Bool("preserve-xattrs", false, "保留扩展属性（仅Linux）")
+		fileTimeout  = flag.Duration("file-timeout", 0, "单个文件处理超时（如 30s，0 表示不限制）")
+		manifest     = flag.String("manifest", "", "增量模式清单文件，跳过上次成功处理后未变化的文件")
+		journal      = flag.String("journal", "", "撤销日志文件，记录每次改动以便通过 undo 子命令恢复")
+		replace      = flag.String("replace", "fail", "非法序列和无法表示的字符的处理: fail, substitute, entity")
+		verify       = flag.Bool("verify", false, "写入后做往返校验，有损转换的文件计为失败并保持原样")
+		transaction  = flag.Bool("transaction", false, "事务模式：全部文件成功才写入，否则不改动任何文件")
+		withBinary   = flag.Bool("include-binary", false, "强制处理内容像二进制的文件（默认跳过）")
+		lineEnding   = flag.String("eol", "keep", "换行符: keep 保持原样, lf, crlf, native 当前系统的换行符")
+		normalize    = flag.String("normalize", "none", "转码后的Unicode规范化: none, NFC, NFD, NFKC")
+		bomPolicy    = flag.String("bom", "keep", "输出的BOM: keep 保留输入的BOM, strip 去掉, add 总是添加")
+		bomExts      = flag.String("bom-ext", "", "只为这些扩展名的文件添加BOM，逗号分隔（如 csv,tsv），其他文件去掉BOM；设置后忽略 -bom")
+		sourceEnc    = flag.String("source-encoding", "", "强制指定源编码，跳过自动检测")
+		encodingHint = flag.String("encoding-hint", "", "提示编码，数据能按该编码无误解码时优先采用")
+		charsetDecl  = flag.Bool("charset-decl", true, "识别HTML、XML、CSS、Python文件内的字符集声明作为检测提示，并改为目标编码")
+		rules        encodingRules
 	)
+	flag.Var(&rules, "encoding-rule", "按路径指定提示编码，格式 模式=编码（如 'big5/**=BIG5'），可重复")
+	flag.Var(forceRules{&rules}, "force-encoding", "按路径强制指定源编码，格式同 -encoding-rule，可重复")
 
 	flag.Parse()
 
 	if *inputPath == "" {
 		fmt.Println("用法: go run main.go -input <文件或目录路径>")
+		fmt.Println("      go run main.go manifest <inspect|prune|reset> -manifest <清单文件>")
+		fmt.Println("      go run main.go undo -journal <撤销日志>")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
@@ -45,6 +80,26 @@ func main() {
 		converter.WithDryRun(*dryRun),
 		converter.WithConcurrency(*concurrent),
 		converter.WithOverwrite(true),
+		converter.WithPreserveTimes(*keepTimes),
+		converter.WithPreserveOwner(*keepOwner),
+		converter.WithPreserveXattrs(*keepXattrs),
+		converter.WithFileTimeout(*fileTimeout),
+		converter.WithManifest(*manifest),
+		converter.WithJournal(*journal),
+		converter.WithTransaction(*transaction),
+		converter.WithVerify(*verify),
+		converter.WithReplacementPolicy(converter.ReplacementPolicy(*replace)),
+		converter.WithIncludeBinary(*withBinary),
+		converter.WithLineEnding(converter.LineEnding(*lineEnding)),
+		converter.WithNormalization(converter.Normalization(*normalize)),
+		converter.WithBOMPolicy(converter.BOMPolicy(*bomPolicy)),
+		converter.WithSourceEncoding(*sourceEnc),
+		converter.WithEncodingHint(*encodingHint),
+		converter.WithEncodingRules(rules...),
+		converter.WithCharsetDeclarations(*charsetDecl),
+	}
+	if *bomExts != "" {
+		options = append(options, converter.WithBOMExtensions(strings.Split(*bomExts, ",")...))
 	}
 
 	// 添加进度回调
@@ -52,18 +107,37 @@ func main() {
 		options = append(options, converter.WithProgress(func(progress converter.Progress) {
 			switch progress.Status {
 			case converter.StatusStarting:
-				fmt.Printf("开始处理... 总文件数: %d\n", progress.TotalFiles)
+				if progress.Discovering {
+					fmt.Println("开始处理... 正在查找文件")
+				} else {
+					fmt.Printf("开始处理... 总文件数: %d\n", progress.TotalFiles)
+				}
 			case converter.StatusProcessing:
-				fmt.Printf("处理中: %s\n", progress.CurrentFile)
+				if progress.CurrentFile == "" {
+					fmt.Printf("文件查找完成，总文件数: %d\n", progress.TotalFiles)
+				} else {
+					fmt.Printf("处理中: %s\n", progress.CurrentFile)
+				}
 			case converter.StatusCompleted:
 				fmt.Printf("✓ 完成: %s\n", progress.CurrentFile)
 			case converter.StatusFailed:
 				fmt.Printf("✗ 失败: %s\n", progress.CurrentFile)
 			case converter.StatusSkipped:
 				fmt.Printf("- 跳过: %s\n", progress.CurrentFile)
+			case converter.StatusLowConfidence:
+				fmt.Printf("? 置信度不足，跳过: %s\n", progress.CurrentFile)
+			case converter.StatusBinary:
+				fmt.Printf("? 二进制文件，跳过: %s\n", progress.CurrentFile)
+			case converter.StatusUnchanged:
+				fmt.Printf("= 已是UTF-8，无需转换: %s\n", progress.CurrentFile)
+			case converter.StatusUpToDate:
+				fmt.Printf("= 上次处理后未变化，跳过: %s\n", progress.CurrentFile)
 			}
 
-			if progress.ProcessedFiles > 0 {
+			if progress.ProcessedFiles > 0 && progress.Discovering {
+				fmt.Printf("进度: %d/%d+ (仍在查找文件) - 错误: %d\n",
+					progress.ProcessedFiles, progress.TotalFiles, progress.ErrorCount)
+			} else if progress.ProcessedFiles > 0 {
 				percentage := float64(progress.ProcessedFiles) / float64(progress.TotalFiles) * 100
 				fmt.Printf("进度: %d/%d (%.1f%%) - 错误: %d\n",
 					progress.ProcessedFiles, progress.TotalFiles, percentage, progress.ErrorCount)
@@ -88,12 +162,16 @@ func main() {
 		return false
 	}))
 
+	// Ctrl-C 时停止启动新文件，已在处理的文件完成或回滚
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	var result *converter.BatchResult
 
 	if stat.IsDir() {
 		// 处理目录
 		fmt.Printf("处理目录: %s\n", *inputPath)
-		result, err = converter.ConvertDirectory(*inputPath, options...)
+		result, err = converter.ConvertDirectoryContext(ctx, *inputPath, options...)
 	} else {
 		// 处理单个文件
 		fmt.Printf("处理文件: %s\n", *inputPath)
@@ -102,7 +180,7 @@ func main() {
 			outputFile = *inputPath // 覆盖原文件
 		}
 
-		convertResult, err := converter.ConvertFile(*inputPath, outputFile, options...)
+		convertResult, err := converter.ConvertFileContext(ctx, *inputPath, outputFile, options...)
 		if err != nil {
 			log.Fatalf("转换失败: %v", err)
 		}
@@ -116,20 +194,38 @@ func main() {
 			ProcessingTime:  convertResult.ProcessingTime,
 			TotalBytes:      convertResult.BytesProcessed,
 		}
+		if convertResult.OutputAction == converter.OutputUnchanged {
+			result.UnchangedFiles = 1
+		}
 	}
 
 	if err != nil {
-		log.Fatalf("处理失败: %v", err)
+		if result == nil || !result.Cancelled {
+			log.Fatalf("处理失败: %v", err)
+		}
+		fmt.Printf("\n处理已取消: %v（以下为部分结果）\n", err)
 	}
 
 	// 打印结果摘要
-	fmt.Println("\n========== 处理完成 ==========")
+	if *dryRun {
+		fmt.Println("\n========== 试运行完成（未写入任何文件） ==========")
+	} else {
+		fmt.Println("\n========== 处理完成 ==========")
+	}
 	fmt.Printf("总文件数: %d\n", result.TotalFiles)
 	fmt.Printf("成功转换: %d\n", result.SuccessfulFiles)
+	fmt.Printf("已是UTF-8: %d\n", result.UnchangedFiles)
 	fmt.Printf("失败: %d\n", result.FailedFiles)
 	fmt.Printf("跳过: %d\n", result.SkippedFiles)
 	fmt.Printf("处理时间: %v\n", result.ProcessingTime)
 	fmt.Printf("处理字节数: %d\n", result.TotalBytes)
+	if *transaction && !*dryRun && stat.IsDir() {
+		if result.Committed {
+			fmt.Println("事务: 已提交全部输出")
+		} else {
+			fmt.Println("事务: 未提交，原文件保持不变")
+		}
+	}
 
 	if len(result.Errors) > 0 {
 		fmt.Println("\n错误详情:")
@@ -138,6 +234,10 @@ func main() {
 		}
 	}
 
+	if *dryRun {
+		printPlan(result)
+	}
+
 	if *verbose && len(result.Results) > 0 {
 		fmt.Println("\n详细结果:")
 		for _, res := range result.Results {
@@ -150,7 +250,109 @@ func main() {
 			if res.BackupFile != "" {
 				fmt.Printf("  备份文件: %s\n", res.BackupFile)
 			}
+			if endings := res.LineEndings; endings != (converter.LineEndingCounts{}) {
+				mixed := ""
+				if endings.Mixed() {
+					mixed = "（混用）"
+				}
+				fmt.Printf("  换行符: LF %d, CRLF %d, CR %d%s\n", endings.LF, endings.CRLF, endings.CR, mixed)
+			}
+			if res.NormalizedCount > 0 {
+				fmt.Printf("  规范化字符: %d 处\n", res.NormalizedCount)
+			}
+			if res.DeclarationCount > 0 {
+				fmt.Printf("  字符集声明: %s -> %s（%d 处）\n", res.DeclaredEncoding, res.TargetEncoding, res.DeclarationCount)
+			}
+			if res.InputBOM != res.OutputBOM {
+				fmt.Printf("  BOM: %s -> %s\n", bomName(res.InputBOM), bomName(res.OutputBOM))
+			}
+			if res.Verification != "" {
+				fmt.Printf("  往返校验: %s\n", res.Verification)
+			}
+			if res.ReplacementCount > 0 {
+				fmt.Printf("  替换字符: %d 处\n", res.ReplacementCount)
+				for _, r := range res.Replacements {
+					fmt.Printf("    %d:%d (偏移 %d) %s\n", r.Line, r.Column, r.Offset, r.Kind)
+				}
+			}
+			if res.Metadata != nil {
+				for _, metaErr := range res.Metadata.Errors {
+					fmt.Printf("  元数据未保留: %s\n", metaErr)
+				}
+			}
 			fmt.Println()
 		}
 	}
 }
+
+// bomName 返回BOM的显示名称
+func bomName(bom converter.BOM) string {
+	if bom == converter.BOMNone {
+		return "无"
+	}
+	return string(bom)
+}
+
+// encodingRules 可重复的 模式=编码 参数，按出现顺序匹配
+type encodingRules []converter.EncodingRule
+
+func (r *encodingRules) String() string {
+	return ""
+}
+
+func (r *encodingRules) Set(value string) error {
+	return r.add(value, false)
+}
+
+func (r *encodingRules) add(value string, force bool) error {
+	pattern, encoding, ok := strings.Cut(value, "=")
+	if !ok || pattern == "" || encoding == "" {
+		return fmt.Errorf("格式应为 模式=编码: %s", value)
+	}
+	*r = append(*r, converter.EncodingRule{Pattern: pattern, Encoding: encoding, Force: force})
+	return nil
+}
+
+// forceRules 把强制编码的规则追加到同一张规则表
+type forceRules struct {
+	rules *encodingRules
+}
+
+func (f forceRules) String() string {
+	return ""
+}
+
+func (f forceRules) Set(value string) error {
+	return f.rules.add(value, true)
+}
+
+// printPlan 打印试运行的转换计划，按文件路径排序便于审阅
+func printPlan(result *converter.BatchResult) {
+	results := make([]*converter.ConvertResult, len(result.Results))
+	copy(results, result.Results)
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].InputFile < results[j].InputFile
+	})
+
+	changed := 0
+	fmt.Println("\n转换计划:")
+	for _, res := range results {
+		action := "无变化"
+		switch {
+		case res.OutputAction == converter.OutputSkipped:
+			action = "跳过"
+		case res.OutputAction == converter.OutputUnchanged:
+			action = "已是UTF-8"
+		case res.Changed:
+			action = "将改写"
+			changed++
+		}
+		fmt.Printf("[%s] %s\n", action, res.InputFile)
+		fmt.Printf("  编码: %s -> %s (置信度 %.2f)\n", res.SourceEncoding, res.TargetEncoding, res.DetectionConfidence)
+		fmt.Printf("  大小: %d -> %d 字节\n", res.BytesProcessed, res.OutputBytes)
+		if res.OutputFile != res.InputFile {
+			fmt.Printf("  输出: %s\n", res.OutputFile)
+		}
+	}
+	fmt.Printf("\n共 %d 个文件将被改写，%d 个文件无需改写\n", changed, len(results)-changed)
+}
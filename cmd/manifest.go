@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	converter "github.com/mirbf/ConvertContent2UTF8"
+)
+
+// runManifest 处理manifest子命令：查看、清理或重置增量模式清单
+func runManifest(args []string) {
+	fs := flag.NewFlagSet("manifest", flag.ExitOnError)
+	path := fs.String("manifest", "", "清单文件路径")
+
+	if len(args) == 0 {
+		fmt.Println("用法: go run main.go manifest <inspect|prune|reset> -manifest <清单文件>")
+		os.Exit(1)
+	}
+	command := args[0]
+	fs.Parse(args[1:])
+
+	if *path == "" {
+		fmt.Println("错误: 必须通过 -manifest 指定清单文件")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	manifest, err := converter.LoadManifest(*path)
+	if err != nil {
+		log.Fatalf("加载清单失败: %v", err)
+	}
+
+	switch command {
+	case "inspect":
+		entries := manifest.Entries()
+		for _, entry := range entries {
+			fmt.Printf("%s\n", entry.Path)
+			fmt.Printf("  编码: %s -> %s  结果: %s\n", entry.SourceEncoding, entry.TargetEncoding, entry.Outcome)
+			fmt.Printf("  大小: %d 字节  修改时间: %s\n", entry.Size, entry.ModTime.Format("2006-01-02 15:04:05"))
+			fmt.Printf("  记录时间: %s\n", entry.UpdatedAt.Format("2006-01-02 15:04:05"))
+		}
+		fmt.Printf("\n共 %d 条记录\n", len(entries))
+
+	case "prune":
+		removed := manifest.Prune()
+		if err := manifest.Save(); err != nil {
+			log.Fatalf("保存清单失败: %v", err)
+		}
+		for _, path := range removed {
+			fmt.Printf("- %s\n", path)
+		}
+		fmt.Printf("已清理 %d 条记录（文件已不存在）\n", len(removed))
+
+	case "reset":
+		count := len(manifest.Entries())
+		manifest.Reset()
+		if err := manifest.Save(); err != nil {
+			log.Fatalf("保存清单失败: %v", err)
+		}
+		fmt.Printf("已清空 %d 条记录\n", count)
+
+	default:
+		log.Fatalf("未知的清单命令: %s（可用: inspect, prune, reset）", command)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -8,8 +9,7 @@ import (
 	"strings"
 	"time"
 
-	encoding "github.com/mirbf/encoding-processor"
-	"github.com/mirbf/ConvertContent2UTF8"
+	ConvertContent2UTF8 "github.com/mirbf/ConvertContent2UTF8"
 )
 
 func main() {
@@ -40,31 +40,7 @@ func main() {
 	fmt.Printf("转换失败目录: %s\n", errorDir)
 	fmt.Println()
 
-	// 进度回调函数
-	progressCallback := func(p ConvertContent2UTF8.Progress) {
-		percentage := float64(p.ProcessedFiles) / float64(p.TotalFiles) * 100
-
-		switch p.Status {
-		case ConvertContent2UTF8.StatusStarting:
-			fmt.Printf("🚀 开始处理 %d 个文件...\n", p.TotalFiles)
-		case ConvertContent2UTF8.StatusProcessing:
-			fmt.Printf("⏳ [%.1f%%] 正在处理: %s\n", percentage, filepath.Base(p.CurrentFile))
-		case ConvertContent2UTF8.StatusCompleted:
-			fmt.Printf("✅ [%.1f%%] 完成: %s\n", percentage, filepath.Base(p.CurrentFile))
-		case ConvertContent2UTF8.StatusFailed:
-			fmt.Printf("❌ [%.1f%%] 失败: %s\n", percentage, filepath.Base(p.CurrentFile))
-		case ConvertContent2UTF8.StatusSkipped:
-			fmt.Printf("⏭️  [%.1f%%] 跳过: %s\n", percentage, filepath.Base(p.CurrentFile))
-		}
-
-		if p.ProcessedFiles == p.TotalFiles {
-			fmt.Printf("\n📊 处理完成统计:\n")
-			fmt.Printf("   总计耗时: %v\n", p.ElapsedTime)
-			fmt.Printf("   错误数量: %d\n", p.ErrorCount)
-		}
-	}
-
-	// 收集所有文件并检查编码
+	// 收集所有文件
 	start := time.Now()
 	files, err := collectAllFiles(sourceDir)
 	if err != nil {
@@ -78,45 +54,48 @@ func main() {
 
 	fmt.Printf("找到 %d 个文件，开始处理...\n\n", len(files))
 
-	// 分类处理文件
+	// 原地转换每个文件，已是UTF-8的文件由转换器判定为无需转换，不会被改写
+	conv := ConvertContent2UTF8.NewConverter(
+		ConvertContent2UTF8.WithOverwrite(true),
+		ConvertContent2UTF8.WithBackup(false),
+		ConvertContent2UTF8.WithPreserveTimes(true),
+	)
+
 	alreadyUTF8Files := []*FileInfo{}
-	needConvertFiles := []*FileInfo{}
+	successFiles := []*FileInfo{}
 	errorFiles := []*FileInfo{}
 
-	// 检查每个文件的编码
 	for i, fileInfo := range files {
 		percentage := float64(i+1) / float64(len(files)) * 100
-		fmt.Printf("[%.1f%%] 检查文件编码: %s\n", percentage, filepath.Base(fileInfo.Path))
+		fmt.Printf("[%.1f%%] 处理文件: %s\n", percentage, filepath.Base(fileInfo.Path))
 
-		// 检测文件编码（降低置信度要求）
-		config := encoding.GetDefaultDetectorConfig()
-		config.MinConfidence = 0.3 // 降低置信度要求到0.3
-		detector := encoding.NewDetector(config)
-		detectResult, err := detector.DetectFileEncoding(fileInfo.Path)
+		result, err := conv.ConvertFile(context.Background(), fileInfo.Path, fileInfo.Path)
 		if err != nil {
-			fmt.Printf("❌ 编码检测失败: %s\n", err)
+			fmt.Printf("❌ 转换失败: %s\n", err)
 			fileInfo.Error = err.Error()
+			fileInfo.Status = "error"
 			errorFiles = append(errorFiles, fileInfo)
 			continue
 		}
 
-		fileInfo.DetectedEncoding = detectResult.Encoding
-		fileInfo.Confidence = detectResult.Confidence
+		fileInfo.DetectedEncoding = result.SourceEncoding
+		fileInfo.Confidence = result.DetectionConfidence
 
-		// 如果已经是UTF-8，直接移动到has目录
-		if strings.ToUpper(detectResult.Encoding) == "UTF-8" {
+		if result.OutputAction == ConvertContent2UTF8.OutputUnchanged {
 			fmt.Printf("ℹ️  已是UTF-8编码，移动到has目录\n")
+			fileInfo.Status = "utf8"
 			alreadyUTF8Files = append(alreadyUTF8Files, fileInfo)
 		} else {
-			fmt.Printf("🔄 需要转换编码: %s -> UTF-8\n", detectResult.Encoding)
-			needConvertFiles = append(needConvertFiles, fileInfo)
+			fmt.Printf("✅ 转换成功: %s -> UTF-8\n", result.SourceEncoding)
+			fileInfo.Status = "success"
+			successFiles = append(successFiles, fileInfo)
 		}
 	}
 
-	fmt.Printf("\n编码检查完成:\n")
+	fmt.Printf("\n处理完成:\n")
 	fmt.Printf("  已是UTF-8: %d 个文件\n", len(alreadyUTF8Files))
-	fmt.Printf("  需要转换: %d 个文件\n", len(needConvertFiles))
-	fmt.Printf("  检测失败: %d 个文件\n\n", len(errorFiles))
+	fmt.Printf("  转换成功: %d 个文件\n", len(successFiles))
+	fmt.Printf("  转换失败: %d 个文件\n\n", len(errorFiles))
 
 	// 移动已经是UTF-8的文件
 	if len(alreadyUTF8Files) > 0 {
@@ -124,28 +103,16 @@ func main() {
 		moveFiles(alreadyUTF8Files, alreadyUTF8Dir, "已是UTF-8")
 	}
 
-	// 移动检测失败的文件
-	if len(errorFiles) > 0 {
-		fmt.Println("移动编码检测失败的文件到error目录...")
-		moveFiles(errorFiles, errorDir, "检测失败")
+	// 移动转换成功的文件
+	if len(successFiles) > 0 {
+		fmt.Println("移动转换成功的文件到UTF8目录...")
+		moveFiles(successFiles, utf8Dir, "转换成功")
 	}
 
-	// 转换需要转换的文件
-	if len(needConvertFiles) > 0 {
-		fmt.Printf("开始转换 %d 个文件...\n", len(needConvertFiles))
-		successFiles, failFiles := convertFiles(needConvertFiles, progressCallback)
-
-		// 移动转换成功的文件
-		if len(successFiles) > 0 {
-			fmt.Println("移动转换成功的文件到UTF8目录...")
-			moveFiles(successFiles, utf8Dir, "转换成功")
-		}
-
-		// 移动转换失败的文件
-		if len(failFiles) > 0 {
-			fmt.Println("移动转换失败的文件到error目录...")
-			moveFiles(failFiles, errorDir, "转换失败")
-		}
+	// 移动转换失败的文件
+	if len(errorFiles) > 0 {
+		fmt.Println("移动转换失败的文件到error目录...")
+		moveFiles(errorFiles, errorDir, "转换失败")
 	}
 
 	fmt.Printf("\n📈 最终结果:\n")
@@ -229,58 +196,6 @@ func collectAllFiles(dirPath string) ([]*FileInfo, error) {
 	return files, err
 }
 
-// convertFiles 转换文件
-func convertFiles(files []*FileInfo, progressCallback func(ConvertContent2UTF8.Progress)) ([]*FileInfo, []*FileInfo) {
-	var successFiles []*FileInfo
-	var failFiles []*FileInfo
-
-	for i, fileInfo := range files {
-		percentage := float64(i+1) / float64(len(files)) * 100
-		fmt.Printf("[%.1f%%] 转换文件: %s\n", percentage, filepath.Base(fileInfo.Path))
-
-		// 创建临时输出文件
-		tempOutputFile := fileInfo.Path + ".utf8.tmp"
-
-		// 使用encoding-processor转换文件
-		fileProcessor := encoding.NewDefaultFile()
-		processOptions := &encoding.FileProcessOptions{
-			TargetEncoding:    "UTF-8",
-			MinConfidence:     0.8,
-			CreateBackup:      false,
-			OverwriteExisting: true,
-			DryRun:            false,
-			PreserveMode:      true,
-			PreserveTime:      true,
-		}
-
-		result, err := fileProcessor.ProcessFile(fileInfo.Path, tempOutputFile, processOptions)
-		if err != nil {
-			fmt.Printf("❌ 转换失败: %s\n", err)
-			fileInfo.Error = err.Error()
-			fileInfo.Status = "error"
-			failFiles = append(failFiles, fileInfo)
-			// 清理临时文件
-			os.Remove(tempOutputFile)
-		} else {
-			fmt.Printf("✅ 转换成功: %s -> UTF-8\n", result.SourceEncoding)
-			// 用转换后的文件替换原文件
-			err = os.Rename(tempOutputFile, fileInfo.Path)
-			if err != nil {
-				fmt.Printf("❌ 替换文件失败: %s\n", err)
-				fileInfo.Error = err.Error()
-				fileInfo.Status = "error"
-				failFiles = append(failFiles, fileInfo)
-				os.Remove(tempOutputFile)
-			} else {
-				fileInfo.Status = "success"
-				successFiles = append(successFiles, fileInfo)
-			}
-		}
-	}
-
-	return successFiles, failFiles
-}
-
 // moveFiles 移动文件到指定目录
 func moveFiles(files []*FileInfo, targetDir, operation string) {
 	successCount := 0
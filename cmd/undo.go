@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	converter "github.com/mirbf/ConvertContent2UTF8"
+)
+
+// runUndo 处理undo子命令：按撤销日志恢复转换前的文件
+func runUndo(args []string) {
+	fs := flag.NewFlagSet("undo", flag.ExitOnError)
+	path := fs.String("journal", "", "撤销日志文件路径")
+	fs.Parse(args)
+
+	if *path == "" {
+		fmt.Println("错误: 必须通过 -journal 指定撤销日志")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	result, err := converter.Undo(*path)
+	if result != nil {
+		for _, file := range result.Restored {
+			fmt.Printf("✓ 已恢复: %s\n", file)
+		}
+		for _, file := range result.Removed {
+			fmt.Printf("- 已删除: %s\n", file)
+		}
+		for _, fileErr := range result.Errors {
+			fmt.Printf("✗ %s (%s): %s\n", fileErr.File, fileErr.Operation, fileErr.Error)
+		}
+		fmt.Printf("\n恢复: %d  删除: %d  失败: %d\n", len(result.Restored), len(result.Removed), len(result.Errors))
+	}
+	if err != nil {
+		log.Fatalf("撤销失败: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		fmt.Println("未能撤销的记录仍保留在日志中")
+		os.Exit(1)
+	}
+}
@@ -1,7 +1,12 @@
 package convertcontent2utf8
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,21 +16,51 @@ import (
 	encoding "github.com/mirbf/encoding-processor"
 )
 
+// Converter 可复用的转换器，由选项构建一次，配置和编码处理器在各次调用间共享
+// 构建后配置不再改变，可安全地并发使用；进度回调可能被并发调用
+type Converter struct {
+	config    *Config
+	processor encoding.Processor
+
+	// 增量清单在首次使用时加载，之后各次调用共用同一份，避免并发保存时互相覆盖
+	manifestMutex sync.Mutex
+	manifest      *Manifest
+}
+
+// NewConverter 根据选项创建转换器
+func NewConverter(options ...Option) *Converter {
+	return &Converter{
+		config:    applyOptions(options),
+		processor: encoding.NewSmartProcessor(),
+	}
+}
+
 // ConvertFile 转换单个文件
 func ConvertFile(inputFile, outputFile string, options ...Option) (*ConvertResult, error) {
-	config := applyOptions(options)
+	return NewConverter(options...).ConvertFile(context.Background(), inputFile, outputFile)
+}
+
+// ConvertFileContext 转换单个文件，上下文取消或超时时放弃写入
+func ConvertFileContext(ctx context.Context, inputFile, outputFile string, options ...Option) (*ConvertResult, error) {
+	return NewConverter(options...).ConvertFile(ctx, inputFile, outputFile)
+}
+
+// ConvertFile 转换单个文件，上下文取消或超时时放弃写入
+// 错误都是*ConvertError；输出已写入但清单或撤销日志保存失败时，同时返回结果和错误
+func (c *Converter) ConvertFile(ctx context.Context, inputFile, outputFile string) (*ConvertResult, error) {
+	config := c.config
 
 	// 参数验证
 	if inputFile == "" {
-		return nil, fmt.Errorf("input file path cannot be empty")
+		return nil, newConvertError(inputFile, OpRead, fmt.Errorf("%w: input file path cannot be empty", ErrInvalidArgument))
 	}
 	if outputFile == "" {
-		return nil, fmt.Errorf("output file path cannot be empty")
+		return nil, newConvertError(inputFile, OpWrite, fmt.Errorf("%w: output file path cannot be empty", ErrInvalidArgument))
 	}
 
 	// 检查输入文件是否存在
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return nil, fmt.Errorf("input file does not exist: %s", inputFile)
+	if _, err := os.Stat(inputFile); err != nil {
+		return nil, newConvertError(inputFile, OpRead, fmt.Errorf("cannot access input file: %w", err))
 	}
 
 	// 进度回调
@@ -43,9 +78,6 @@ func ConvertFile(inputFile, outputFile string, options ...Option) (*ConvertResul
 
 	start := time.Now()
 
-	// 创建智能编码处理器
-	processor := encoding.NewSmartProcessor()
-
 	// 进度更新 - 处理中
 	if config.ProgressCallback != nil {
 		progress := Progress{
@@ -60,70 +92,63 @@ func ConvertFile(inputFile, outputFile string, options ...Option) (*ConvertResul
 		config.ProgressCallback(progress)
 	}
 
-	// 读取文件内容
-	data, err := os.ReadFile(inputFile)
+	env, operation, err := c.openFileEnv("")
 	if err != nil {
-		// 进度更新 - 失败
-		if config.ProgressCallback != nil {
-			progress := Progress{
-				CurrentFile:    inputFile,
-				ProcessedFiles: 0,
-				TotalFiles:     1,
-				Status:         StatusFailed,
-				StartTime:      time.Now(),
-				ElapsedTime:    time.Since(start),
-				ErrorCount:     1,
-			}
-			config.ProgressCallback(progress)
-		}
-		return nil, fmt.Errorf("failed to read file: %w", err)
+		return nil, newConvertError(inputFile, operation, err)
 	}
 
-	// 使用智能转换（自动检测源编码）
-	processorResult, err := processor.SmartConvert(data, config.TargetEncoding)
+	fileCtx, cancel := withFileTimeout(ctx, config)
+	defer cancel()
+
+	result, operation, err := convertFile(fileCtx, config, c.processor, env, inputFile, outputFile)
+	if closeOperation, closeErr := env.close(); closeErr != nil && err == nil {
+		// 输出已写入，只是清单或撤销日志未能保存
+		operation, err = closeOperation, closeErr
+	}
+	if result != nil {
+		result.ProcessingTime = time.Since(start)
+	}
 	if err != nil {
-		// 进度更新 - 失败
+		// 进度更新 - 失败或低置信度跳过
 		if config.ProgressCallback != nil {
+			status := StatusFailed
+			switch operation {
+			case OpLowConfidence:
+				status = StatusLowConfidence
+			case OpBinary:
+				status = StatusBinary
+			}
 			progress := Progress{
 				CurrentFile:    inputFile,
 				ProcessedFiles: 0,
 				TotalFiles:     1,
-				Status:         StatusFailed,
+				Status:         status,
 				StartTime:      time.Now(),
 				ElapsedTime:    time.Since(start),
 				ErrorCount:     1,
 			}
 			config.ProgressCallback(progress)
 		}
-		return nil, fmt.Errorf("failed to convert file %s: %w", inputFile, err)
-	}
 
-	// 写入转换后的数据
-	err = os.WriteFile(outputFile, processorResult.Data, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write file %s: %w", outputFile, err)
+		return result, newConvertError(inputFile, operation, err)
 	}
 
-	// 构建返回结果
-	result := &ConvertResult{
-		InputFile:           inputFile,
-		OutputFile:          outputFile,
-		SourceEncoding:      processorResult.SourceEncoding,
-		TargetEncoding:      processorResult.TargetEncoding,
-		BytesProcessed:      processorResult.BytesProcessed,
-		ProcessingTime:      time.Since(start),
-		DetectionConfidence: 1.0, // 智能转换的置信度设为1.0
-		BackupFile:          "",
-		ProcessorResult:     nil,
-	}
-
-	// 进度更新 - 完成
+	// 进度更新 - 完成或跳过
 	if config.ProgressCallback != nil {
+		status := StatusCompleted
+		switch result.OutputAction {
+		case OutputSkipped:
+			status = StatusSkipped
+		case OutputUnchanged:
+			status = StatusUnchanged
+		case OutputUpToDate:
+			status = StatusUpToDate
+		}
 		progress := Progress{
 			CurrentFile:    inputFile,
 			ProcessedFiles: 1,
 			TotalFiles:     1,
-			Status:         StatusCompleted,
+			Status:         status,
 			StartTime:      time.Now(),
 			ElapsedTime:    time.Since(start),
 			ProcessedBytes: result.BytesProcessed,
@@ -137,211 +162,864 @@ func ConvertFile(inputFile, outputFile string, options ...Option) (*ConvertResul
 
 // ConvertFiles 批量转换文件
 func ConvertFiles(files []string, options ...Option) (*BatchResult, error) {
-	config := applyOptions(options)
+	return NewConverter(options...).ConvertFiles(context.Background(), files)
+}
+
+// ConvertFilesContext 批量转换文件
+// 上下文取消后不再开始新文件，处理中的文件完成或回滚，返回标记为已取消的部分结果和上下文错误
+func ConvertFilesContext(ctx context.Context, files []string, options ...Option) (*BatchResult, error) {
+	return NewConverter(options...).ConvertFiles(ctx, files)
+}
 
+// ConvertFiles 批量转换文件，取消语义与ConvertFilesContext相同
+func (c *Converter) ConvertFiles(ctx context.Context, files []string) (*BatchResult, error) {
+	return c.convertFiles(ctx, files, "")
+}
+
+// convertFiles 批量转换文件，root为备份镜像的根目录
+func (c *Converter) convertFiles(ctx context.Context, files []string, root string) (*BatchResult, error) {
 	if len(files) == 0 {
-		return nil, fmt.Errorf("file list cannot be empty")
+		return nil, newConvertError("", OpRead, fmt.Errorf("%w: file list cannot be empty", ErrInvalidArgument))
 	}
 
-	start := time.Now()
-	batchResult := &BatchResult{
-		TotalFiles:     len(files),
-		ProcessingTime: 0,
-		Results:        make([]*ConvertResult, 0, len(files)),
-		Errors:         make([]FileError, 0),
+	// 先打开清单和日志，失败时还没有协程在等待送入
+	run, err := c.newBatchRun(len(files), root)
+	if err != nil {
+		return nil, err
+	}
+
+	// 逐个送入无缓冲通道，工作协程忙时阻塞，上下文结束后停止送入
+	paths := make(chan string)
+	go func() {
+		defer close(paths)
+		for _, file := range files {
+			select {
+			case paths <- file:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c.runBatch(ctx, run, paths)
+}
+
+// batchRun 一次批量转换的共享状态
+type batchRun struct {
+	result      *BatchResult
+	env         *fileEnv
+	start       time.Time
+	discovering bool  // 文件仍在发现中，TotalFiles会继续增加
+	walkErr     error // 遍历目录失败的原因，文件不完整时事务不能提交
+	mutex       sync.Mutex
+}
+
+// newBatchRun 创建批量转换状态
+func (c *Converter) newBatchRun(total int, root string) (*batchRun, error) {
+	env, operation, err := c.openFileEnv(root)
+	if err != nil {
+		return nil, newConvertError(root, operation, err)
+	}
+	if c.config.Transactional && !c.config.DryRun {
+		env.txn = &transaction{}
 	}
 
+	return &batchRun{
+		result: &BatchResult{
+			TotalFiles:     total,
+			ProcessingTime: 0,
+			Results:        make([]*ConvertResult, 0),
+			Errors:         make([]FileError, 0),
+		},
+		env:   env,
+		start: time.Now(),
+	}, nil
+}
+
+// runBatch 用固定数量的工作协程处理paths中的文件，直到通道关闭
+// 协程数量由ConcurrencyLimit决定，与文件数量无关
+func (c *Converter) runBatch(ctx context.Context, run *batchRun, paths <-chan string) (*BatchResult, error) {
+	config := c.config
+
 	// 进度初始化
 	if config.ProgressCallback != nil {
+		run.mutex.Lock()
 		progress := Progress{
 			CurrentFile:    "",
 			ProcessedFiles: 0,
-			TotalFiles:     len(files),
+			TotalFiles:     run.result.TotalFiles,
+			Discovering:    run.discovering,
 			Status:         StatusStarting,
-			StartTime:      start,
+			StartTime:      run.start,
 			ErrorCount:     0,
 		}
+		run.mutex.Unlock()
 		config.ProgressCallback(progress)
 	}
 
-	// 并发控制
-	semaphore := make(chan struct{}, config.ConcurrencyLimit)
-	var wg sync.WaitGroup
-	var mutex sync.Mutex
+	workers := config.ConcurrencyLimit
+	if workers < 1 {
+		workers = 1
+	}
 
-	// 处理每个文件
-	for i, file := range files {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
-		go func(index int, filePath string) {
+		go func() {
 			defer wg.Done()
-			semaphore <- struct{}{}        // 获取信号量
-			defer func() { <-semaphore }() // 释放信号量
-
-			// 应用文件过滤器
-			if config.FileFilter != nil && !config.FileFilter(filePath) {
-				mutex.Lock()
-				batchResult.SkippedFiles++
-				batchResult.ProcessedFiles++
-				mutex.Unlock()
-
-				if config.ProgressCallback != nil {
-					mutex.Lock()
-					progress := Progress{
-						CurrentFile:    filePath,
-						ProcessedFiles: batchResult.ProcessedFiles,
-						TotalFiles:     len(files),
-						Status:         StatusSkipped,
-						StartTime:      start,
-						ElapsedTime:    time.Since(start),
-						ErrorCount:     len(batchResult.Errors),
-					}
-					mutex.Unlock()
-					config.ProgressCallback(progress)
+			for filePath := range paths {
+				// 上下文已结束，放弃已取出的文件
+				if ctx.Err() != nil {
+					continue
 				}
-				return
+				c.batchFile(ctx, run, filePath)
 			}
+		}()
+	}
 
-			// 生成输出文件名
-			outputFile := generateOutputFileName(filePath, config.TargetEncoding)
-
-			// 转换单个文件（不使用ConvertFile以避免重复的进度回调）
-			processor := encoding.NewSmartProcessor()
+	wg.Wait()
+	batchResult := run.result
+	run.mutex.Lock()
+	walkErr := run.walkErr
+	run.mutex.Unlock()
 
-			// 读取文件内容
-			data, err := os.ReadFile(filePath)
+	// 事务模式下全部文件成功且目录完整遍历才提交，否则丢弃暂存区，原文件保持不变；跳过的二进制文件不影响提交
+	if txn := run.env.txn; txn != nil {
+		if ctx.Err() == nil && walkErr == nil && !hasBlockingErrors(batchResult.Errors) {
+			file, err := txn.commit(config, run.env)
 			if err != nil {
-				mutex.Lock()
-				batchResult.FailedFiles++
-				batchResult.Errors = append(batchResult.Errors, FileError{
-					File:      filePath,
-					Operation: "read",
-					Error:     err.Error(),
-					Timestamp: time.Now(),
-				})
-				mutex.Unlock()
-				return
+				err = fmt.Errorf("%w: %w", ErrCommitFailed, err)
+				batchResult.Errors = append(batchResult.Errors, newFileError(file, OpCommit, err))
+				batchResult.ProcessingTime = time.Since(run.start)
+				var batchErr error = newConvertError(file, OpCommit, err)
+				if operation, closeErr := run.env.close(); closeErr != nil {
+					batchErr = errors.Join(batchErr, newConvertError("", operation, closeErr))
+				}
+				return batchResult, batchErr
 			}
+			// 目标文件已全部替换，撤销日志或清单写入失败只作为单个文件的错误报告
+			batchResult.Committed = true
+			batchResult.Errors = append(batchResult.Errors, txn.record(run.env)...)
+		} else {
+			txn.discard()
+		}
+	}
+	batchResult.ProcessingTime = time.Since(run.start)
 
-			// 使用智能转换（自动检测源编码）
-			processorResult, err := processor.SmartConvert(data, config.TargetEncoding)
-			if err != nil {
-				mutex.Lock()
-				batchResult.FailedFiles++
-				batchResult.Errors = append(batchResult.Errors, FileError{
-					File:      filePath,
-					Operation: "convert",
-					Error:     err.Error(),
-					Timestamp: time.Now(),
-				})
-				mutex.Unlock()
-				return
-			}
+	// 取消时也保存清单和日志，已完成的文件下次无需重新处理，也可以撤销
+	if operation, err := run.env.close(); err != nil {
+		return batchResult, newConvertError("", operation, err)
+	}
 
-			// 写入转换后的数据
-			err = os.WriteFile(outputFile, processorResult.Data, 0644)
-			if err != nil {
-				mutex.Lock()
-				batchResult.FailedFiles++
-				batchResult.Errors = append(batchResult.Errors, FileError{
-					File:      filePath,
-					Operation: "write",
-					Error:     err.Error(),
-					Timestamp: time.Now(),
-				})
-				mutex.Unlock()
-				return
-			}
+	if err := ctx.Err(); err != nil {
+		batchResult.Cancelled = true
+		return batchResult, err
+	}
+
+	return batchResult, nil
+}
+
+// newFileError 创建批量结果中的文件错误
+func newFileError(file, operation string, err error) FileError {
+	return FileError{
+		File:      file,
+		Operation: operation,
+		Error:     err.Error(),
+		Err:       newConvertError(file, operation, err),
+		Timestamp: time.Now(),
+	}
+}
+
+// hasBlockingErrors 判断是否有阻止事务提交的错误
+func hasBlockingErrors(fileErrors []FileError) bool {
+	for _, fileErr := range fileErrors {
+		if fileErr.Operation != OpBinary {
+			return true
+		}
+	}
+	return false
+}
+
+// batchFile 转换批量中的单个文件并记录结果
+func (c *Converter) batchFile(ctx context.Context, run *batchRun, filePath string) {
+	config := c.config
+	batchResult := run.result
+	start := run.start
+	mutex := &run.mutex
 
+	// 应用文件过滤器
+	if config.FileFilter != nil && !config.FileFilter(filePath) {
+		mutex.Lock()
+		batchResult.SkippedFiles++
+		batchResult.ProcessedFiles++
+		mutex.Unlock()
+
+		if config.ProgressCallback != nil {
 			mutex.Lock()
-			batchResult.ProcessedFiles++
-			batchResult.SuccessfulFiles++
-			batchResult.TotalBytes += processorResult.BytesProcessed
-
-			// 构建我们的ConvertResult
-			ourResult := &ConvertResult{
-				InputFile:           filePath,
-				OutputFile:          outputFile,
-				SourceEncoding:      processorResult.SourceEncoding,
-				TargetEncoding:      processorResult.TargetEncoding,
-				BytesProcessed:      processorResult.BytesProcessed,
-				ProcessingTime:      processorResult.ConversionTime,
-				DetectionConfidence: 1.0, // 智能转换的置信度设为1.0
-				BackupFile:          "",
-				ProcessorResult:     nil,
+			progress := Progress{
+				CurrentFile:    filePath,
+				ProcessedFiles: batchResult.ProcessedFiles,
+				TotalFiles:     batchResult.TotalFiles,
+				Discovering:    run.discovering,
+				Status:         StatusSkipped,
+				StartTime:      start,
+				ElapsedTime:    time.Since(start),
+				ErrorCount:     len(batchResult.Errors),
 			}
-			batchResult.Results = append(batchResult.Results, ourResult)
-
-			// 进度回调
-			if config.ProgressCallback != nil {
-				status := StatusCompleted
-
-				progress := Progress{
-					CurrentFile:    filePath,
-					ProcessedFiles: batchResult.ProcessedFiles,
-					TotalFiles:     len(files),
-					Status:         status,
-					StartTime:      start,
-					ElapsedTime:    time.Since(start),
-					ErrorCount:     len(batchResult.Errors),
-				}
+			mutex.Unlock()
+			config.ProgressCallback(progress)
+		}
+		return
+	}
 
-				if batchResult.ProcessedFiles > 0 {
-					remaining := len(files) - batchResult.ProcessedFiles
-					avgTime := time.Since(start) / time.Duration(batchResult.ProcessedFiles)
-					progress.EstimatedTime = time.Duration(remaining) * avgTime
-				}
+	// 生成输出文件名
+	outputFile := generateOutputFileName(filePath, config.TargetEncoding)
 
-				config.ProgressCallback(progress)
-			}
+	// 转换单个文件（不使用ConvertFile以避免重复的进度回调）
+	fileCtx, cancel := withFileTimeout(ctx, config)
+	ourResult, operation, err := convertFile(fileCtx, config, c.processor, run.env, filePath, outputFile)
+	cancel()
+	if err != nil {
+		// 整批被取消时，中途放弃的文件不计为失败
+		if operation == OpTimeout && ctx.Err() != nil {
+			operation = OpCancelled
+		}
+
+		mutex.Lock()
+		batchResult.Errors = append(batchResult.Errors, newFileError(filePath, operation, err))
+		if operation == OpCancelled {
 			mutex.Unlock()
-		}(i, file)
+			return
+		}
+		if operation != OpLowConfidence && operation != OpBinary {
+			batchResult.FailedFiles++
+			mutex.Unlock()
+			return
+		}
+
+		// 低置信度和二进制文件计为跳过
+		batchResult.SkippedFiles++
+		batchResult.ProcessedFiles++
+		if config.ProgressCallback != nil {
+			status := StatusLowConfidence
+			if operation == OpBinary {
+				status = StatusBinary
+			}
+			progress := Progress{
+				CurrentFile:    filePath,
+				ProcessedFiles: batchResult.ProcessedFiles,
+				TotalFiles:     batchResult.TotalFiles,
+				Discovering:    run.discovering,
+				Status:         status,
+				StartTime:      start,
+				ElapsedTime:    time.Since(start),
+				ErrorCount:     len(batchResult.Errors),
+			}
+			config.ProgressCallback(progress)
+		}
+		mutex.Unlock()
+		return
 	}
 
-	wg.Wait()
-	batchResult.ProcessingTime = time.Since(start)
+	mutex.Lock()
+	batchResult.ProcessedFiles++
+	switch ourResult.OutputAction {
+	case OutputSkipped, OutputUpToDate:
+		batchResult.SkippedFiles++
+	case OutputUnchanged:
+		batchResult.UnchangedFiles++
+		batchResult.SuccessfulFiles++
+	default:
+		batchResult.SuccessfulFiles++
+	}
+	batchResult.TotalBytes += ourResult.BytesProcessed
 
-	return batchResult, nil
+	// 设置了结果回调时逐个交给调用方，不在内存中累积
+	if config.ResultCallback != nil {
+		config.ResultCallback(ourResult)
+	} else {
+		batchResult.Results = append(batchResult.Results, ourResult)
+	}
+
+	// 进度回调
+	if config.ProgressCallback != nil {
+		status := StatusCompleted
+		switch ourResult.OutputAction {
+		case OutputSkipped:
+			status = StatusSkipped
+		case OutputUnchanged:
+			status = StatusUnchanged
+		case OutputUpToDate:
+			status = StatusUpToDate
+		}
+
+		progress := Progress{
+			CurrentFile:    filePath,
+			ProcessedFiles: batchResult.ProcessedFiles,
+			TotalFiles:     batchResult.TotalFiles,
+			Discovering:    run.discovering,
+			Status:         status,
+			StartTime:      start,
+			ElapsedTime:    time.Since(start),
+			ErrorCount:     len(batchResult.Errors),
+		}
+
+		// 仍在发现文件时总数未知，不估算剩余时间
+		if batchResult.ProcessedFiles > 0 && !run.discovering {
+			remaining := batchResult.TotalFiles - batchResult.ProcessedFiles
+			avgTime := time.Since(start) / time.Duration(batchResult.ProcessedFiles)
+			progress.EstimatedTime = time.Duration(remaining) * avgTime
+		}
+
+		config.ProgressCallback(progress)
+	}
+	mutex.Unlock()
 }
 
 // ConvertDirectory 递归转换目录中的文件
 func ConvertDirectory(dirPath string, options ...Option) (*BatchResult, error) {
-	config := applyOptions(options)
+	return NewConverter(options...).ConvertDirectory(context.Background(), dirPath)
+}
+
+// ConvertDirectoryContext 转换目录中的文件，取消语义与ConvertFilesContext相同
+func ConvertDirectoryContext(ctx context.Context, dirPath string, options ...Option) (*BatchResult, error) {
+	return NewConverter(options...).ConvertDirectory(ctx, dirPath)
+}
+
+// ConvertDirectory 转换目录中的文件，取消语义与ConvertFilesContext相同
+func (c *Converter) ConvertDirectory(ctx context.Context, dirPath string) (*BatchResult, error) {
+	config := c.config
 
 	// 检查目录是否存在
-	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("directory does not exist: %s", dirPath)
+	if _, err := os.Stat(dirPath); err != nil {
+		return nil, newConvertError(dirPath, OpRead, fmt.Errorf("cannot access directory: %w", err))
 	}
 
-	// 收集文件列表
-	files, err := collectFiles(dirPath, config)
+	// 边遍历边转换：遍历协程发现文件后送入工作协程，工作协程忙时遍历阻塞
+	run, err := c.newBatchRun(0, dirPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to collect files from directory %s: %w", dirPath, err)
+		return nil, err
 	}
+	run.discovering = true
+	paths := make(chan string)
+	go func() {
+		defer close(paths)
+		walkErr := walkFiles(ctx, dirPath, config, func(path string) error {
+			run.mutex.Lock()
+			run.result.TotalFiles++
+			run.mutex.Unlock()
 
-	if len(files) == 0 {
-		return &BatchResult{
-			TotalFiles:     0,
-			ProcessingTime: 0,
-			Results:        make([]*ConvertResult, 0),
-			Errors:         make([]FileError, 0),
+			select {
+			case paths <- path:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+
+		// 遍历结束后报告最终的文件总数
+		run.mutex.Lock()
+		run.discovering = false
+		run.walkErr = walkErr
+		if config.ProgressCallback != nil && walkErr == nil {
+			config.ProgressCallback(Progress{
+				ProcessedFiles: run.result.ProcessedFiles,
+				TotalFiles:     run.result.TotalFiles,
+				Status:         StatusProcessing,
+				StartTime:      run.start,
+				ElapsedTime:    time.Since(run.start),
+				ErrorCount:     len(run.result.Errors),
+			})
+		}
+		run.mutex.Unlock()
+	}()
+
+	result, err := c.runBatch(ctx, run, paths)
+	if err != nil {
+		return result, err
+	}
+	if run.walkErr != nil {
+		return result, newConvertError(dirPath, OpWalk, fmt.Errorf("%w: %w", ErrWalkFailed, run.walkErr))
+	}
+	return result, nil
+}
+
+// fileEnv 一次运行中各文件共享的备份、清单和撤销日志
+type fileEnv struct {
+	backups  *backupManager
+	manifest *Manifest    // 增量模式的清单，未启用时为nil
+	journal  *journal     // 撤销日志，未启用时为nil
+	txn      *transaction // 事务模式的暂存区，未启用时为nil
+}
+
+// openFileEnv 按配置准备一次运行共享的组件，root为备份镜像的根目录，失败时返回出错的操作名称
+func (c *Converter) openFileEnv(root string) (*fileEnv, string, error) {
+	manifest, err := c.loadManifest()
+	if err != nil {
+		return nil, OpManifest, err
+	}
+	journal, err := openJournal(c.config)
+	if err != nil {
+		return nil, OpJournal, err
+	}
+	return &fileEnv{
+		backups:  newBackupManager(c.config, root),
+		manifest: manifest,
+		journal:  journal,
+	}, "", nil
+}
+
+// loadManifest 返回转换器共用的清单，首次调用时加载，加载失败时下次调用重试
+func (c *Converter) loadManifest() (*Manifest, error) {
+	c.manifestMutex.Lock()
+	defer c.manifestMutex.Unlock()
+
+	if c.manifest == nil {
+		manifest, err := loadManifest(c.config)
+		if err != nil {
+			return nil, err
+		}
+		c.manifest = manifest
+	}
+	return c.manifest, nil
+}
+
+// close 保存清单并关闭撤销日志，返回第一个错误和出错的操作名称
+func (e *fileEnv) close() (string, error) {
+	operation, err := OpManifest, e.manifest.save()
+	if closeErr := e.journal.close(); err == nil {
+		operation, err = OpJournal, closeErr
+	}
+	if err == nil {
+		return "", nil
+	}
+	return operation, err
+}
+
+// convertFile 转换单个文件；启用增量模式时跳过清单中未变化的文件，并记录成功的结果
+func convertFile(ctx context.Context, config *Config, processor encoding.Processor, env *fileEnv, inputFile, outputFile string) (*ConvertResult, string, error) {
+	manifest := env.manifest
+	if result := manifest.upToDate(config, inputFile, outputFile); result != nil {
+		return withVerification(config, result), "", nil
+	}
+
+	result, operation, err := processFile(ctx, config, processor, env, inputFile, outputFile)
+	if err != nil {
+		return nil, operation, err
+	}
+	withVerification(config, result)
+	// 事务模式下输出尚未提交，提交时再记录
+	if env.txn != nil {
+		return result, "", nil
+	}
+	if err := manifest.record(inputFile, outputFile, result); err != nil {
+		return nil, OpManifest, err
+	}
+	return result, "", nil
+}
+
+// processFile 读取、转换并写入单个文件，失败时返回出错的操作名称
+// 在各步骤之间检查上下文，结束时放弃该文件且不写入任何内容
+func processFile(ctx context.Context, config *Config, processor encoding.Processor, env *fileEnv, inputFile, outputFile string) (*ConvertResult, string, error) {
+	start := time.Now()
+
+	// 跳过内容为二进制的文件，避免按文本转换而损坏
+	if err := checkBinaryFile(config, inputFile); err != nil {
+		if errors.Is(err, ErrBinaryFile) {
+			return nil, OpBinary, err
+		}
+		return nil, OpRead, err
+	}
+
+	// 原地转换已是UTF-8的文件时不改写，避免修改时间变化；先于已存在策略，因为不会写入任何内容
+	if config.checksUnchanged(inputFile, outputFile) {
+		result, err := unchangedResult(config, inputFile, outputFile)
+		if err != nil {
+			return nil, OpRead, err
+		}
+		if result != nil {
+			return result, "", nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, contextOperation(err), err
+		}
+	}
+
+	// 按策略处理已存在的输出文件
+	action, err := resolveOutput(config, outputFile)
+	if err != nil {
+		return nil, OpOutputExists, err
+	}
+	if action == OutputSkipped {
+		return &ConvertResult{
+			InputFile:      inputFile,
+			OutputFile:     outputFile,
+			TargetEncoding: config.TargetEncoding,
+			DryRun:         config.DryRun,
+			OutputAction:   OutputSkipped,
+			ProcessingTime: time.Since(start),
+		}, "", nil
+	}
+
+	// 捕获源文件元数据，写入时保留，同时用文件大小选择转换方式
+	meta, err := captureMetadata(config, inputFile)
+	if err != nil {
+		return nil, OpRead, err
+	}
+	if config.MaxFileSize > 0 && meta.info.Size() > config.MaxFileSize {
+		return nil, OpRead, fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, meta.info.Size(), config.MaxFileSize)
+	}
+
+	var conv *conversion
+	var operation string
+	if config.StreamThreshold > 0 && meta.info.Size() > config.StreamThreshold {
+		var file *os.File
+		file, err = os.Open(inputFile)
+		if err != nil {
+			return nil, OpRead, err
+		}
+		defer file.Close()
+		conv, operation, err = prepareStream(ctx, config, processor, file)
+	} else {
+		conv, operation, err = prepareInMemory(ctx, config, processor, inputFile, outputFile, action)
+	}
+	if err != nil {
+		return nil, operation, err
+	}
+	result := conv.result
+	result.InputFile = inputFile
+	result.OutputFile = outputFile
+	result.DryRun = config.DryRun
+	result.OutputAction = action
+
+	// 改名策略下选择唯一的输出路径，非试运行时同时占位
+	if action == OutputRenamed {
+		result.OutputFile, err = uniqueOutputPath(outputFile, !config.DryRun)
+		if err != nil {
+			return nil, OpWrite, withEncoding(err, result.SourceEncoding)
+		}
+	}
+
+	// 试运行模式不写入任何文件，流式转换时转码到io.Discard以统计输出大小
+	if config.DryRun {
+		if conv.streamed {
+			if err := conv.write(io.Discard); err != nil {
+				return nil, conv.failedOperation(ctx), withEncoding(err, result.SourceEncoding)
+			}
+		}
+		result.ProcessingTime = time.Since(start)
+		return result, "", nil
+	}
+
+	// 事务模式只写入暂存文件，备份、撤销日志和替换目标文件都留到提交时进行
+	if env.txn != nil {
+		if err := env.txn.stage(ctx, config, conv, meta, inputFile, outputFile); err != nil {
+			if action == OutputRenamed {
+				os.Remove(result.OutputFile)
+			}
+			return nil, conv.failedOperation(ctx), withEncoding(err, result.SourceEncoding)
+		}
+		result.ProcessingTime = time.Since(start)
+		return result, "", nil
+	}
+
+	// 覆盖前备份已存在的输出文件
+	if config.CreateBackup && action == OutputOverwritten {
+		backupFile, err := env.backups.backup(outputFile)
+		if err != nil {
+			return nil, OpBackup, withEncoding(err, result.SourceEncoding)
+		}
+		result.BackupFile = backupFile
+	}
+
+	// 记录撤销日志，覆盖前保存原内容
+	entry, err := env.journal.snapshot(result.OutputFile, action)
+	if err != nil {
+		return nil, OpJournal, withEncoding(err, result.SourceEncoding)
+	}
+
+	// 流式原地转换时边读边写会截断源文件，往返校验失败时需要放弃写入，这两种情况强制经临时文件原子写入
+	writeConfig := config
+	if !config.AtomicWrite && (config.Verify || conv.streamed && sameFile(inputFile, result.OutputFile)) {
+		atomic := *config
+		atomic.AtomicWrite = true
+		writeConfig = &atomic
+	}
+
+	// 写入转换后的数据
+	result.Metadata, err = writeOutput(ctx, writeConfig, result.OutputFile, conv.write, conv.verifier(ctx, config, inputFile), meta)
+	if err != nil {
+		if action == OutputRenamed {
+			os.Remove(result.OutputFile)
+		}
+		env.journal.discard(entry)
+		return nil, conv.failedOperation(ctx), withEncoding(err, result.SourceEncoding)
+	}
+	if err := env.journal.commit(entry, result.OutputFile); err != nil {
+		return nil, OpJournal, withEncoding(err, result.SourceEncoding)
+	}
+	if config.Verify {
+		result.Verification = VerifyPassed
+	}
+
+	result.ProcessingTime = time.Since(start)
+	return result, "", nil
+}
+
+// conversion 已完成检测、等待写入的转换
+type conversion struct {
+	result          *ConvertResult
+	write           func(io.Writer) error // 产生输出内容
+	streamed        bool                  // 写入时才读取并转码源文件
+	transcodeFailed bool                  // 流式写入失败源于读取或转码，而非写入输出
+	verifyFailed    bool                  // 写入失败源于往返校验未通过
+}
+
+// failedOperation 返回写入失败对应的操作名称，上下文结束优先
+func (c *conversion) failedOperation(ctx context.Context) string {
+	if err := ctx.Err(); err != nil {
+		return contextOperation(err)
+	}
+	if c.verifyFailed {
+		return OpVerify
+	}
+	if c.transcodeFailed {
+		return OpConvert
+	}
+	return OpWrite
+}
+
+// prepareInMemory 读入整个文件完成检测和转换
+func prepareInMemory(ctx context.Context, config *Config, processor encoding.Processor, inputFile, outputFile string, action OutputAction) (*conversion, string, error) {
+	// 读取文件内容
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		return nil, OpRead, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, contextOperation(err), err
+	}
+
+	converted, result, operation, err := convertData(config, processor, data, inputFile, outputFile)
+	if err != nil {
+		return nil, operation, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, contextOperation(err), err
+	}
+
+	result.Changed = true
+	if action == OutputOverwritten {
+		result.Changed = outputChanged(inputFile, outputFile, data, converted)
+	}
+
+	return &conversion{result: result, write: writeBytes(converted)}, "", nil
+}
+
+// prepareStream 从文件前缀检测编码，写入时才边读边转码，内存占用与文件大小无关
+// 不比较输出文件现有内容，源编码与目标编码或BOM不同、换行符需要统一、有字符被规范化或改写了字符集声明即视为有变化
+func prepareStream(ctx context.Context, config *Config, processor encoding.Processor, file *os.File) (*conversion, string, error) {
+	source, detection, inputBOM, err := detectStream(config, processor, file, file.Name())
+	if err != nil {
+		return nil, OpDetect, err
+	}
+
+	if err := checkConfidence(config, detection); err != nil {
+		return nil, OpLowConfidence, withEncoding(err, detection.Encoding)
+	}
+
+	// 提前确认编码受支持，避免写入开始后才失败
+	if err := checkReplacing(detection.Encoding, config.TargetEncoding); err != nil {
+		return nil, OpConvert, withEncoding(err, detection.Encoding)
+	}
+	outputBOM, err := config.outputBOM(file.Name(), inputBOM)
+	if err != nil {
+		return nil, OpConvert, withEncoding(err, detection.Encoding)
+	}
+	newline, err := newlineFor(config.LineEnding)
+	if err != nil {
+		return nil, OpConvert, withEncoding(err, detection.Encoding)
+	}
+
+	result := &ConvertResult{
+		SourceEncoding:      detection.Encoding,
+		TargetEncoding:      config.TargetEncoding,
+		Changed:             !sameEncoding(detection.Encoding, config.TargetEncoding) || inputBOM != outputBOM,
+		DetectionConfidence: detection.Confidence,
+		InputBOM:            inputBOM,
+		OutputBOM:           outputBOM,
+	}
+
+	conv := &conversion{result: result, streamed: true}
+	conv.write = func(w io.Writer) error {
+		out := &countingWriter{writer: w}
+		log := &replacementLog{}
+		if _, err := out.Write(outputBOM.Bytes()); err != nil {
+			return err
+		}
+		read, written, err := transcodeStream(ctx, config, source, out, detection.Encoding, file.Name(), log)
+		result.BytesProcessed = read + int64(len(inputBOM.Bytes()))
+		result.OutputBytes = written + int64(len(outputBOM.Bytes()))
+		log.apply(result)
+		result.Changed = result.Changed || !log.endings.conforms(newline) || log.normalized > 0 || log.declarations > 0
+		conv.transcodeFailed = err != nil && out.err == nil
+		return err
+	}
+	return conv, "", nil
+}
+
+// convertData 检测内存数据的编码并转换为目标编码，返回转换后的数据和结果，失败时返回出错的操作名称
+// inputFile用于匹配编码规则，outputFile用于按扩展名决定BOM，内存转换时都为空
+func convertData(config *Config, processor encoding.Processor, data []byte, inputFile, outputFile string) ([]byte, *ConvertResult, string, error) {
+	// 确定源编码：BOM、强制编码、提示编码或自动检测
+	detection, inputBOM, err := detectSource(config, processor, data, inputFile, false)
+	if err != nil {
+		return nil, nil, OpDetect, err
+	}
+
+	// 置信度低于阈值时跳过，避免按错误的编码改写文件
+	if err := checkConfidence(config, detection); err != nil {
+		return nil, nil, OpLowConfidence, withEncoding(err, detection.Encoding)
+	}
+
+	outputBOM, err := config.outputBOM(outputFile, inputBOM)
+	if err != nil {
+		return nil, nil, OpConvert, withEncoding(err, detection.Encoding)
+	}
+
+	// 转换BOM之后的内容，按策略处理非法序列和无法表示的字符
+	body, log, err := transcodeData(config, data[len(inputBOM.Bytes()):], detection.Encoding, inputFile)
+	if err != nil {
+		return nil, nil, OpConvert, withEncoding(err, detection.Encoding)
+	}
+	converted := body
+	if outputBOM != BOMNone {
+		converted = append(outputBOM.Bytes(), body...)
+	}
+
+	result := &ConvertResult{
+		SourceEncoding:      detection.Encoding,
+		TargetEncoding:      config.TargetEncoding,
+		BytesProcessed:      int64(len(data)),
+		OutputBytes:         int64(len(converted)),
+		Changed:             !bytes.Equal(data, converted),
+		DetectionConfidence: detection.Confidence,
+		InputBOM:            inputBOM,
+		OutputBOM:           outputBOM,
+	}
+	log.apply(result)
+	return converted, result, "", nil
+}
+
+// checkConfidence 检查检测置信度是否达到阈值
+func checkConfidence(config *Config, detection *encoding.DetectionResult) error {
+	if detection.Confidence < config.MinConfidence {
+		return fmt.Errorf("%w: %.2f for %s, threshold %.2f",
+			ErrLowConfidence, detection.Confidence, detection.Encoding, config.MinConfidence)
+	}
+	return nil
+}
+
+// sameFile 判断两个路径是否指向同一个文件
+func sameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
+
+// withFileTimeout 为单个文件设置处理超时
+func withFileTimeout(ctx context.Context, config *Config) (context.Context, context.CancelFunc) {
+	if config.FileTimeout > 0 {
+		return context.WithTimeout(ctx, config.FileTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// contextOperation 返回上下文结束原因对应的操作名称
+func contextOperation(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return OpTimeout
+	}
+	return OpCancelled
+}
+
+// detectEncoding 检测数据编码，空数据视为UTF-8
+// 只取有界样本检测，并去掉样本末尾截断的多字节序列，避免UTF-8文件因截断被误判
+// 样本判为UTF-8而完整数据不是合法UTF-8时（如很长的ASCII开头之后是GBK），从第一个非法序列处重新取样检测
+func detectEncoding(processor encoding.Processor, data []byte) (*encoding.DetectionResult, error) {
+	if len(data) == 0 {
+		return &encoding.DetectionResult{
+			Encoding:   encoding.EncodingUTF8,
+			Confidence: 1.0,
 		}, nil
 	}
+	sample := data
+	if len(data) >= detectionSampleSize {
+		sample = trimIncompleteUTF8(data[:detectionSampleSize])
+	}
+	detection, err := processor.DetectEncoding(sample)
+	if err != nil || len(sample) == len(data) || !isUTF8Name(detection.Encoding) {
+		return detection, err
+	}
+
+	start := invalidUTF8(trimIncompleteUTF8(data))
+	if start < 0 {
+		return detection, nil
+	}
+	return processor.DetectEncoding(data[start:min(len(data), start+detectionSampleSize)])
+}
 
-	// 使用ConvertFiles处理收集到的文件
-	return ConvertFiles(files, options...)
+// outputChanged 判断转换结果是否会改变输出文件的现有内容
+func outputChanged(inputFile, outputFile string, input, output []byte) bool {
+	existing := input
+	if filepath.Clean(inputFile) != filepath.Clean(outputFile) {
+		var err error
+		existing, err = os.ReadFile(outputFile)
+		if err != nil {
+			return true
+		}
+	}
+	return !bytes.Equal(existing, output)
 }
 
-// collectFiles 收集目录中的文件
-func collectFiles(dirPath string, config *Config) ([]string, error) {
-	var files []string
+// walkFiles 遍历目录，将符合条件的文件逐个交给emit，emit返回错误时停止遍历
+func walkFiles(ctx context.Context, dirPath string, config *Config, emit func(path string) error) error {
+	backups := newBackupManager(config, dirPath)
 
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	return filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// 跳过备份目录
+		if backups.isBackupPath(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// 跳过撤销日志及其原内容副本、事务暂存文件
+		if config.isJournalPath(path) || isStagingName(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
 		// 跳过目录
-		if info.IsDir() {
+		if d.IsDir() {
 			// 如果不是递归模式且当前目录不是根目录，跳过
 			if !config.Recursive && path != dirPath {
 				return filepath.SkipDir
@@ -350,13 +1028,19 @@ func collectFiles(dirPath string, config *Config) ([]string, error) {
 		}
 
 		// 跳过隐藏文件
-		if config.SkipHidden && strings.HasPrefix(info.Name(), ".") {
+		if config.SkipHidden && strings.HasPrefix(d.Name(), ".") {
 			return nil
 		}
 
-		// 检查文件大小限制
-		if config.MaxFileSize > 0 && info.Size() > config.MaxFileSize {
-			return nil
+		// 检查文件大小限制，只在需要时读取文件信息
+		if config.MaxFileSize > 0 {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if info.Size() > config.MaxFileSize {
+				return nil
+			}
 		}
 
 		// 应用文件过滤器
@@ -364,11 +1048,8 @@ func collectFiles(dirPath string, config *Config) ([]string, error) {
 			return nil
 		}
 
-		files = append(files, path)
-		return nil
+		return emit(path)
 	})
-
-	return files, err
 }
 
 // generateOutputFileName 生成输出文件名
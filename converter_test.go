@@ -1,12 +1,22 @@
 package convertcontent2utf8
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
+// gbkSample GBK编码的"这是一个测试文件，包含中文内容。"
+const gbkSample = "\xd5\xe2\xca\xc7\xd2\xbb\xb8\xf6\xb2\xe2\xca\xd4\xce\xc4\xbc\xfe\xa3\xac" +
+	"\xb0\xfc\xba\xac\xd6\xd0\xce\xc4\xc4\xda\xc8\xdd\xa1\xa3"
+
 func TestConvertFile(t *testing.T) {
 	// 创建临时测试目录
 	testDir := t.TempDir()
@@ -330,6 +340,382 @@ func TestConvertDirectory(t *testing.T) {
 	})
 }
 
+func TestPipelinedDirectory(t *testing.T) {
+	testDir := t.TempDir()
+	for i := 0; i < 50; i++ {
+		file := filepath.Join(testDir, fmt.Sprintf("file%02d.txt", i))
+		if err := os.WriteFile(file, []byte(gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	var events []Progress
+	result, err := ConvertDirectory(testDir,
+		WithOverwrite(true),
+		WithBackup(false),
+		WithConcurrency(1),
+		WithProgress(func(p Progress) {
+			events = append(events, p)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("ConvertDirectory failed: %v", err)
+	}
+
+	if result.TotalFiles != 50 || result.SuccessfulFiles != 50 {
+		t.Errorf("Expected 50 total and successful files, got %d and %d", result.TotalFiles, result.SuccessfulFiles)
+	}
+	if len(events) == 0 || !events[0].Discovering || events[0].Status != StatusStarting {
+		t.Fatalf("Expected first progress to be starting while discovering, got %+v", events)
+	}
+
+	// 遍历协程最多领先工作协程一个文件，第一个文件完成时遍历一定尚未结束
+	if events[1].Status != StatusCompleted || !events[1].Discovering {
+		t.Errorf("Expected conversion to start before the walk finished, got %+v", events[1])
+	}
+	last := events[len(events)-1]
+	if last.Discovering || last.TotalFiles != 50 {
+		t.Errorf("Expected final progress with complete total, got %+v", last)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	testDir := t.TempDir()
+	file := filepath.Join(testDir, "dry_run.txt")
+	output := filepath.Join(testDir, "dry_run_output.txt")
+
+	gbkContent := []byte(gbkSample)
+	if err := os.WriteFile(file, gbkContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	t.Run("单文件试运行", func(t *testing.T) {
+		result, err := ConvertFile(file, output, WithDryRun(true))
+		if err != nil {
+			t.Fatalf("ConvertFile dry run failed: %v", err)
+		}
+		if !result.DryRun {
+			t.Error("Expected DryRun to be recorded in result")
+		}
+		if !result.Changed {
+			t.Error("Expected Changed to be true for a new output file")
+		}
+		if result.OutputBytes <= 0 {
+			t.Errorf("Expected OutputBytes > 0, got %d", result.OutputBytes)
+		}
+		if result.BackupFile != "" {
+			t.Errorf("Expected no backup in dry run, got %s", result.BackupFile)
+		}
+		if _, err := os.Stat(output); !os.IsNotExist(err) {
+			t.Error("Output file should not be created in dry run")
+		}
+	})
+
+	t.Run("批量试运行", func(t *testing.T) {
+		result, err := ConvertFiles([]string{file}, WithDryRun(true), WithOverwrite(true))
+		if err != nil {
+			t.Fatalf("ConvertFiles dry run failed: %v", err)
+		}
+		if result.SuccessfulFiles != 1 {
+			t.Fatalf("Expected SuccessfulFiles 1, got %d", result.SuccessfulFiles)
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(data) != string(gbkContent) {
+			t.Error("Input file should not be modified in dry run")
+		}
+		if _, err := os.Stat(file + ".bak"); !os.IsNotExist(err) {
+			t.Error("Backup should not be created in dry run")
+		}
+	})
+
+	t.Run("无变化的文件", func(t *testing.T) {
+		utf8File := filepath.Join(testDir, "utf8.txt")
+		if err := os.WriteFile(utf8File, []byte("已经是UTF-8"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(utf8File, utf8File, WithDryRun(true), WithOverwrite(true))
+		if err != nil {
+			t.Fatalf("ConvertFile dry run failed: %v", err)
+		}
+		if result.Changed {
+			t.Error("Expected Changed to be false for UTF-8 input")
+		}
+	})
+}
+
+func TestMinConfidence(t *testing.T) {
+	testDir := t.TempDir()
+
+	// 过短的GBK内容检测置信度很低
+	lowFile := filepath.Join(testDir, "low.txt")
+	lowContent := []byte{0xd6, 0xd0, 0xce, 0xc4, 0xc4, 0xda, 0xc8, 0xdd}
+	if err := os.WriteFile(lowFile, lowContent, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	highFile := filepath.Join(testDir, "high.txt")
+	if err := os.WriteFile(highFile, []byte(gbkSample), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	t.Run("真实置信度", func(t *testing.T) {
+		result, err := ConvertFile(highFile, filepath.Join(testDir, "high_out.txt"))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.DetectionConfidence < 0.8 || result.DetectionConfidence > 1.0 {
+			t.Errorf("Unexpected DetectionConfidence %f", result.DetectionConfidence)
+		}
+		if result.SourceEncoding == "UTF-8" {
+			t.Errorf("Expected a legacy source encoding, got %s", result.SourceEncoding)
+		}
+	})
+
+	t.Run("低置信度单文件", func(t *testing.T) {
+		var statuses []ProgressStatus
+		_, err := ConvertFile(lowFile, filepath.Join(testDir, "low_out.txt"),
+			WithProgress(func(p Progress) {
+				statuses = append(statuses, p.Status)
+			}))
+		if err == nil {
+			t.Fatal("Expected error for low confidence file")
+		}
+		if statuses[len(statuses)-1] != StatusLowConfidence {
+			t.Errorf("Expected final status %s, got %s", StatusLowConfidence, statuses[len(statuses)-1])
+		}
+	})
+
+	t.Run("低置信度批量跳过", func(t *testing.T) {
+		result, err := ConvertFiles([]string{lowFile, highFile}, WithDryRun(true), WithOverwrite(true))
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if result.SkippedFiles != 1 {
+			t.Errorf("Expected SkippedFiles 1, got %d", result.SkippedFiles)
+		}
+		if result.FailedFiles != 0 {
+			t.Errorf("Expected FailedFiles 0, got %d", result.FailedFiles)
+		}
+		if len(result.Errors) != 1 || result.Errors[0].Operation != "low_confidence" {
+			t.Errorf("Expected one low_confidence error, got %+v", result.Errors)
+		}
+	})
+
+	t.Run("降低阈值", func(t *testing.T) {
+		result, err := ConvertFile(lowFile, filepath.Join(testDir, "low_out.txt"), WithMinConfidence(0.05))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.DetectionConfidence >= 0.8 {
+			t.Errorf("Expected low DetectionConfidence, got %f", result.DetectionConfidence)
+		}
+	})
+}
+
+func TestConvertContext(t *testing.T) {
+	testDir := t.TempDir()
+	files := make([]string, 5)
+	for i := range files {
+		files[i] = filepath.Join(testDir, "ctx"+string(rune('1'+i))+".txt")
+		if err := os.WriteFile(files[i], []byte(gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	t.Run("取消后不再处理", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		result, err := ConvertFilesContext(ctx, files, WithOverwrite(true))
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected context.Canceled, got %v", err)
+		}
+		if result == nil || !result.Cancelled {
+			t.Fatal("Expected a partial result marked as cancelled")
+		}
+		if result.SuccessfulFiles != 0 {
+			t.Errorf("Expected SuccessfulFiles 0, got %d", result.SuccessfulFiles)
+		}
+
+		for _, file := range files {
+			data, _ := os.ReadFile(file)
+			if string(data) != gbkSample {
+				t.Errorf("File %s should not be modified after cancellation", file)
+			}
+		}
+	})
+
+	t.Run("目录转换取消", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := ConvertDirectoryContext(ctx, testDir, WithOverwrite(true)); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("单文件取消", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := ConvertFileContext(ctx, files[0], files[0], WithOverwrite(true))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("单文件超时", func(t *testing.T) {
+		result, err := ConvertFilesContext(context.Background(), files,
+			WithOverwrite(true),
+			WithFileTimeout(time.Nanosecond),
+		)
+		if err != nil {
+			t.Fatalf("ConvertFilesContext failed: %v", err)
+		}
+		if result.Cancelled {
+			t.Error("Per-file timeouts should not cancel the batch")
+		}
+		if result.FailedFiles != len(files) {
+			t.Errorf("Expected FailedFiles %d, got %d", len(files), result.FailedFiles)
+		}
+		for _, e := range result.Errors {
+			if e.Operation != "timeout" {
+				t.Errorf("Expected operation timeout, got %s", e.Operation)
+			}
+		}
+		assertNoTempFiles(t, testDir)
+	})
+}
+
+func TestConverter(t *testing.T) {
+	converter := NewConverter(WithOverwrite(true), WithBackup(false))
+
+	t.Run("并发复用", func(t *testing.T) {
+		testDir := t.TempDir()
+		files := make([]string, 8)
+		for i := range files {
+			files[i] = filepath.Join(testDir, fmt.Sprintf("file%d.txt", i))
+			if err := os.WriteFile(files[i], []byte(gbkSample), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, len(files)*2)
+		for _, file := range files {
+			wg.Add(2)
+			go func(file string) {
+				defer wg.Done()
+				_, err := converter.ConvertFile(context.Background(), file, file)
+				errs <- err
+			}(file)
+			go func() {
+				defer wg.Done()
+				converted, _, err := converter.ConvertBytes([]byte(gbkSample))
+				if err == nil && string(converted) != gbkSampleText {
+					err = fmt.Errorf("unexpected output %q", converted)
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Errorf("Concurrent conversion failed: %v", err)
+			}
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(data) != gbkSampleText {
+				t.Errorf("Expected %s to be converted, got %q", file, data)
+			}
+		}
+	})
+
+	t.Run("批量和目录", func(t *testing.T) {
+		testDir := t.TempDir()
+		file := filepath.Join(testDir, "test.txt")
+		if err := os.WriteFile(file, []byte(gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := converter.ConvertDirectory(context.Background(), testDir)
+		if err != nil {
+			t.Fatalf("ConvertDirectory failed: %v", err)
+		}
+		if result.SuccessfulFiles != 1 {
+			t.Errorf("Expected 1 successful file, got %d", result.SuccessfulFiles)
+		}
+
+		result, err = converter.ConvertFiles(context.Background(), []string{file})
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if result.SuccessfulFiles != 1 {
+			t.Errorf("Expected 1 successful file, got %d", result.SuccessfulFiles)
+		}
+	})
+}
+
+func TestWorkerPool(t *testing.T) {
+	testDir := t.TempDir()
+	files := make([]string, 200)
+	for i := range files {
+		files[i] = filepath.Join(testDir, fmt.Sprintf("file%03d.txt", i))
+		if err := os.WriteFile(files[i], []byte(gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	var active, maxActive int32
+	received := 0
+	result, err := ConvertFiles(files,
+		WithOverwrite(true),
+		WithBackup(false),
+		WithConcurrency(2),
+		WithFileFilter(func(string) bool {
+			n := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				m := atomic.LoadInt32(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			return true
+		}),
+		WithResultCallback(func(r *ConvertResult) {
+			received++
+		}),
+	)
+	if err != nil {
+		t.Fatalf("ConvertFiles failed: %v", err)
+	}
+
+	if result.SuccessfulFiles != len(files) {
+		t.Errorf("Expected SuccessfulFiles %d, got %d", len(files), result.SuccessfulFiles)
+	}
+	if received != len(files) {
+		t.Errorf("Expected %d result callbacks, got %d", len(files), received)
+	}
+	if len(result.Results) != 0 {
+		t.Errorf("Expected results not to be retained, got %d", len(result.Results))
+	}
+	if maxActive > 2 {
+		t.Errorf("Expected at most 2 files in flight, got %d", maxActive)
+	}
+}
+
 func TestProgressStatus(t *testing.T) {
 	testCases := []struct {
 		status   ProgressStatus
@@ -340,6 +726,7 @@ func TestProgressStatus(t *testing.T) {
 		{StatusCompleted, "completed"},
 		{StatusFailed, "failed"},
 		{StatusSkipped, "skipped"},
+		{StatusLowConfidence, "low_confidence"},
 	}
 
 	for _, tc := range testCases {
@@ -389,6 +776,9 @@ func TestConfigDefaults(t *testing.T) {
 	if config.MinConfidence != 0.8 {
 		t.Errorf("Expected default MinConfidence 0.8, got %f", config.MinConfidence)
 	}
+	if config.ReplacementPolicy != ReplaceFail {
+		t.Errorf("Expected default ReplacementPolicy fail, got %s", config.ReplacementPolicy)
+	}
 }
 
 // 性能测试
@@ -0,0 +1,243 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// declarationScanSize 查找字符集声明的范围，与HTML规范预扫描的长度一致
+const declarationScanSize = 1024
+
+// declarationFormat 可在文件内声明字符集的格式，按扩展名判断
+type declarationFormat string
+
+const (
+	formatNone   declarationFormat = ""
+	formatHTML   declarationFormat = "html"   // <meta charset>和http-equiv的content，XHTML还有XML声明
+	formatXML    declarationFormat = "xml"    // <?xml encoding?>
+	formatCSS    declarationFormat = "css"    // @charset
+	formatPython declarationFormat = "python" // 前两行的 coding: 注释（PEP 263）
+)
+
+// declarationFormats 扩展名对应的格式
+var declarationFormats = map[string]declarationFormat{
+	".html":  formatHTML,
+	".htm":   formatHTML,
+	".shtml": formatHTML,
+	".xhtml": formatHTML,
+	".xml":   formatXML,
+	".svg":   formatXML,
+	".xsd":   formatXML,
+	".xsl":   formatXML,
+	".xslt":  formatXML,
+	".rss":   formatXML,
+	".css":   formatCSS,
+	".py":    formatPython,
+	".pyw":   formatPython,
+}
+
+var (
+	xmlDeclaration    = regexp.MustCompile(`^<\?xml\s[^>]*?\bencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+	htmlMeta          = regexp.MustCompile(`(?i)<meta\s[^>]*?\bcharset\s*=\s*["']?\s*([A-Za-z0-9._:-]+)`)
+	cssCharset        = regexp.MustCompile(`^@charset\s+["']([A-Za-z0-9._:-]+)["']`)
+	pythonCodingLine  = regexp.MustCompile(`^[ \t\f]*#.*?coding[:=][ \t]*([-\w.]+)`)
+	pythonCommentLine = regexp.MustCompile(`^[ \t\f]*(#.*)?$`)
+)
+
+// formatFor 按扩展名返回文件的声明格式，内存和流式转换没有路径时为formatNone
+func formatFor(file string) declarationFormat {
+	return declarationFormats[strings.ToLower(filepath.Ext(file))]
+}
+
+// findDeclarations 返回data开头declarationScanSize字节中字符集名称的位置，每项为[起点, 终点)
+// data超出扫描范围时，紧贴范围末尾的名称可能被截断，不算作声明
+func findDeclarations(format declarationFormat, data []byte) [][2]int {
+	head := data[:min(len(data), declarationScanSize)]
+	cut := len(data) > len(head)
+
+	var found [][2]int
+	add := func(loc []int, offset int) {
+		if loc != nil && !(cut && offset+loc[3] == len(head)) {
+			found = append(found, [2]int{offset + loc[2], offset + loc[3]})
+		}
+	}
+
+	switch format {
+	case formatHTML:
+		add(xmlDeclaration.FindSubmatchIndex(head), 0)
+		for _, loc := range htmlMeta.FindAllSubmatchIndex(head, -1) {
+			add(loc, 0)
+		}
+	case formatXML:
+		add(xmlDeclaration.FindSubmatchIndex(head), 0)
+	case formatCSS:
+		add(cssCharset.FindSubmatchIndex(head), 0)
+	case formatPython:
+		// 声明只能在第一行或第二行，第一行不是注释时第二行的声明无效
+		offset := 0
+		for line := 0; line < 2 && offset < len(head); line++ {
+			end := bytes.IndexByte(head[offset:], '\n')
+			if end < 0 {
+				end = len(head) - offset
+			}
+			text := head[offset : offset+end]
+			if loc := pythonCodingLine.FindSubmatchIndex(text); loc != nil {
+				add(loc, offset)
+				break
+			}
+			if !pythonCommentLine.Match(bytes.TrimSuffix(text, []byte("\r"))) {
+				break
+			}
+			offset += end + 1
+		}
+	}
+	return found
+}
+
+// declaredEncoding 返回data开头第一处声明的字符集名称，没有时返回空
+func declaredEncoding(format declarationFormat, data []byte) string {
+	found := findDeclarations(format, data)
+	if len(found) == 0 {
+		return ""
+	}
+	return string(data[found[0][0]:found[0][1]])
+}
+
+// resolveCharset 把声明中的字符集名称转为支持的编码名称，不认识时返回空
+// 先按本库的名称查找，再按HTML标准的别名表（如"gb2312"、"x-sjis"、"latin1"）
+func resolveCharset(label string) string {
+	if _, err := lookupEncoding(label); err == nil {
+		return strings.ToUpper(label)
+	}
+	e, err := htmlindex.Get(label)
+	if err != nil {
+		return ""
+	}
+	name, err := htmlindex.Name(e)
+	if err != nil {
+		return ""
+	}
+	name = strings.ToUpper(name)
+	if _, err := lookupEncoding(name); err != nil {
+		return ""
+	}
+	return name
+}
+
+// declarationEdit 一处改写：end为新名称在改写后数据中的终点，line为所在行，delta为新名称比原名称多出的字节数
+// 名称都是ASCII，delta同时也是同一行之后各字符列号的变化
+type declarationEdit struct {
+	end   int64
+	line  int
+	delta int64
+}
+
+// rewriteDeclarations 把data开头与目标编码不符的字符集声明改为目标编码，返回改写后的数据和每处改写
+// 原名称全为小写时新名称也用小写
+func rewriteDeclarations(format declarationFormat, data []byte, target string) ([]byte, []declarationEdit) {
+	found := findDeclarations(format, data)
+	if len(found) == 0 {
+		return data, nil
+	}
+
+	name := strings.ToUpper(target)
+	if isUTF8Name(name) {
+		name = "UTF-8"
+	}
+
+	var out []byte
+	var edits []declarationEdit
+	last := 0
+	for _, loc := range found {
+		label := string(data[loc[0]:loc[1]])
+		if sameEncoding(resolveCharset(label), name) {
+			continue
+		}
+		replacement := name
+		if label == strings.ToLower(label) {
+			replacement = strings.ToLower(name)
+		}
+		out = append(out, data[last:loc[0]]...)
+		out = append(out, replacement...)
+		edits = append(edits, declarationEdit{
+			end:   int64(len(out)),
+			line:  lineOf(out),
+			delta: int64(len(replacement) - (loc[1] - loc[0])),
+		})
+		last = loc[1]
+	}
+	if len(edits) == 0 {
+		return data, nil
+	}
+	return append(out, data[last:]...), edits
+}
+
+// lineOf 返回data末尾所在的行号，LF、CRLF和单独的CR都算作换行
+func lineOf(data []byte) int {
+	line := 1
+	for i, b := range data {
+		if b == '\n' || b == '\r' && (i+1 == len(data) || data[i+1] != '\n') {
+			line++
+		}
+	}
+	return line
+}
+
+// declarationRewriter 返回改写文件开头字符集声明的转换器，作用于源编码的数据
+// 未启用、没有可声明字符集的格式或源编码与ASCII不兼容（UTF-16/32）时返回nil
+func (c *Config) declarationRewriter(file, from string, log *replacementLog) transform.Transformer {
+	format := formatFor(file)
+	if !c.CharsetDeclarations || format == formatNone || newNewlineNormalizer(from).width > 1 {
+		return nil
+	}
+	return &declarationTransformer{format: format, target: c.TargetEncoding, log: log}
+}
+
+// declarationTransformer 缓冲开头的declarationScanSize字节改写声明，之后的数据原样输出
+// 多缓冲一个字节，以便判断紧贴范围末尾的名称是否完整
+type declarationTransformer struct {
+	format declarationFormat
+	target string
+	log    *replacementLog
+	done   bool
+}
+
+// Reset 实现transform.Transformer
+func (d *declarationTransformer) Reset() {
+	d.done = false
+}
+
+// Transform 实现transform.Transformer
+func (d *declarationTransformer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	if !d.done {
+		if len(src) <= declarationScanSize && !atEOF {
+			return 0, 0, transform.ErrShortSrc
+		}
+		head := src[:min(len(src), declarationScanSize+1)]
+		rewritten, edits := rewriteDeclarations(d.format, head, d.target)
+		if len(rewritten) > len(dst) {
+			return 0, 0, transform.ErrShortDst
+		}
+		if d.log != nil {
+			d.log.declared = declaredEncoding(d.format, head)
+			d.log.declarations = len(edits)
+			d.log.edits = edits
+		}
+		nDst = copy(dst, rewritten)
+		nSrc = len(head)
+		d.done = true
+	}
+
+	n := copy(dst[nDst:], src[nSrc:])
+	nDst += n
+	nSrc += n
+	if nSrc < len(src) {
+		return nDst, nSrc, transform.ErrShortDst
+	}
+	return nDst, nSrc, nil
+}
@@ -0,0 +1,201 @@
+package convertcontent2utf8
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRewriteDeclarations(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   declarationFormat
+		input    string
+		expected string
+		count    int
+	}{
+		{"HTML meta charset", formatHTML, `<head><meta charset="gbk">`, `<head><meta charset="utf-8">`, 1},
+		{"HTML http-equiv", formatHTML, `<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=GB2312">`, `<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">`, 1},
+		{"XHTML同时有XML声明", formatHTML, `<?xml version="1.0" encoding="GBK"?><html><meta charset="gbk">`, `<?xml version="1.0" encoding="UTF-8"?><html><meta charset="utf-8">`, 2},
+		{"XML声明", formatXML, `<?xml version="1.0" encoding='GB2312'?><a/>`, `<?xml version="1.0" encoding='UTF-8'?><a/>`, 1},
+		{"XML声明不在开头", formatXML, `<a/><?xml version="1.0" encoding="GBK"?>`, `<a/><?xml version="1.0" encoding="GBK"?>`, 0},
+		{"CSS", formatCSS, `@charset "GBK";` + "\nbody{}", `@charset "UTF-8";` + "\nbody{}", 1},
+		{"Python第一行", formatPython, "# -*- coding: gbk -*-\nx = 1\n", "# -*- coding: utf-8 -*-\nx = 1\n", 1},
+		{"Python第二行", formatPython, "#!/usr/bin/env python\r\n# vim: set fileencoding=big5 :\r\n", "#!/usr/bin/env python\r\n# vim: set fileencoding=utf-8 :\r\n", 1},
+		{"Python第一行不是注释", formatPython, "import os\n# coding: gbk\n", "import os\n# coding: gbk\n", 0},
+		{"已是目标编码", formatHTML, `<meta charset="UTF-8">`, `<meta charset="UTF-8">`, 0},
+		{"别名", formatHTML, `<meta charset="utf8">`, `<meta charset="utf8">`, 0},
+		{"不认识的字符集", formatHTML, `<meta charset="x-unknown">`, `<meta charset="utf-8">`, 1},
+		{"没有声明格式", formatNone, `<meta charset="gbk">`, `<meta charset="gbk">`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewritten, edits := rewriteDeclarations(tt.format, []byte(tt.input), "UTF-8")
+			if string(rewritten) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(rewritten))
+			}
+			if len(edits) != tt.count {
+				t.Errorf("Expected %d rewritten, got %d", tt.count, len(edits))
+			}
+		})
+	}
+}
+
+func TestCharsetDeclarations(t *testing.T) {
+	gbkPage := `<html><head><meta charset="gbk"></head><body>` + gbkSample + "</body></html>\n"
+	utf8Page := `<html><head><meta charset="utf-8"></head><body>` + gbkSampleText + "</body></html>\n"
+
+	write := func(t *testing.T, name, content string) string {
+		file := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		return file
+	}
+
+	t.Run("转换后改写声明", func(t *testing.T) {
+		file := write(t, "index.html", gbkPage)
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithVerify(true))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.DeclaredEncoding != "gbk" || result.DeclarationCount != 1 {
+			t.Errorf("Expected gbk declaration rewritten once, got %q, %d", result.DeclaredEncoding, result.DeclarationCount)
+		}
+		if result.Verification != VerifyPassed {
+			t.Errorf("Expected verification to pass, got %s", result.Verification)
+		}
+		content, _ := os.ReadFile(file)
+		if string(content) != utf8Page {
+			t.Errorf("Expected %q, got %q", utf8Page, string(content))
+		}
+	})
+
+	t.Run("流式转换", func(t *testing.T) {
+		file := write(t, "index.html", gbkPage+strings.Repeat(gbkSample+"\n", 500))
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithStreamThreshold(1), WithVerify(true))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.DeclarationCount != 1 || result.Verification != VerifyPassed {
+			t.Errorf("Expected 1 declaration and passed verification, got %d, %s", result.DeclarationCount, result.Verification)
+		}
+		content, _ := os.ReadFile(file)
+		if !strings.HasPrefix(string(content), utf8Page) {
+			t.Errorf("Expected rewritten declaration, got %q", string(content[:len(utf8Page)]))
+		}
+	})
+
+	t.Run("已是UTF-8但声明过时", func(t *testing.T) {
+		stale := strings.Replace(utf8Page, "utf-8", "gbk", 1)
+		file := write(t, "stale.html", stale)
+
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction == OutputUnchanged || result.SourceEncoding != "UTF-8" {
+			t.Errorf("Expected UTF-8 file to be rewritten, got %s from %s", result.OutputAction, result.SourceEncoding)
+		}
+		content, _ := os.ReadFile(file)
+		if string(content) != utf8Page {
+			t.Errorf("Expected %q, got %q", utf8Page, string(content))
+		}
+
+		result, err = ConvertFile(file, file, WithOverwrite(true), WithBackup(false))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputUnchanged || result.DeclaredEncoding != "utf-8" {
+			t.Errorf("Expected unchanged file declaring utf-8, got %s, %q", result.OutputAction, result.DeclaredEncoding)
+		}
+	})
+
+	t.Run("声明作为检测提示", func(t *testing.T) {
+		// Big5编码的"中文"，样本太短，单靠检测置信度很低
+		file := write(t, "big5.py", "# coding: big5\ns = '\xa4\xa4\xa4\xe5'\n")
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.SourceEncoding != "BIG5" {
+			t.Errorf("Expected BIG5 from declaration, got %s", result.SourceEncoding)
+		}
+		content, _ := os.ReadFile(file)
+		if string(content) != "# coding: utf-8\ns = '中文'\n" {
+			t.Errorf("Expected converted Python source, got %q", string(content))
+		}
+	})
+
+	t.Run("关闭时保持原样", func(t *testing.T) {
+		file := write(t, "index.html", gbkPage)
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithCharsetDeclarations(false))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.DeclarationCount != 0 {
+			t.Errorf("Expected no declarations rewritten, got %d", result.DeclarationCount)
+		}
+		content, _ := os.ReadFile(file)
+		if !strings.Contains(string(content), `charset="gbk"`) {
+			t.Errorf("Expected declaration to be kept, got %q", string(content))
+		}
+	})
+
+	t.Run("声明跨越扫描范围边界", func(t *testing.T) {
+		// 名称从第1022字节开始，扫描范围只含"gb"，不能改写为"utf-82312"
+		prefix := `<html><head><meta charset="`
+		page := strings.Repeat(" ", declarationScanSize-2-len(prefix)) + prefix + `gb2312"></head><body>` + gbkSample + "</body></html>\n"
+		for _, threshold := range []int64{0, 1} {
+			file := write(t, "boundary.html", page)
+			result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithStreamThreshold(threshold), WithSourceEncoding("GBK"), WithVerify(true))
+			if err != nil {
+				t.Fatalf("ConvertFile failed: %v", err)
+			}
+			if result.DeclarationCount != 0 || result.Verification != VerifyPassed {
+				t.Errorf("Expected no declarations rewritten and passed verification, got %d, %s", result.DeclarationCount, result.Verification)
+			}
+			content, _ := os.ReadFile(file)
+			if !strings.Contains(string(content), `charset="gb2312"`) {
+				t.Errorf("Expected declaration to be kept, got %q", string(content[declarationScanSize-len(prefix):]))
+			}
+		}
+	})
+
+	t.Run("改写声明后替换位置仍按输入计算", func(t *testing.T) {
+		// 非法字节在输入的第30字节，改写"gbk"为"utf-8"不应影响偏移和列号
+		input := `<meta charset="gbk">` + gbkSample[:10] + "\x81\x20"
+		file := write(t, "invalid.html", input)
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithSourceEncoding("GBK"), WithReplacementPolicy(ReplaceSubstitute))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		_, bytesResult, err := ConvertBytes([]byte(input), WithSourceEncoding("GBK"), WithReplacementPolicy(ReplaceSubstitute))
+		if err != nil {
+			t.Fatalf("ConvertBytes failed: %v", err)
+		}
+
+		for _, res := range []*ConvertResult{result, bytesResult} {
+			if res.ReplacementCount != 1 {
+				t.Fatalf("Expected 1 replacement, got %d", res.ReplacementCount)
+			}
+			if r := res.Replacements[0]; r.Offset != 30 || r.Line != 1 || r.Column != 26 {
+				t.Errorf("Expected offset 30 at 1:26, got %d at %d:%d", r.Offset, r.Line, r.Column)
+			}
+		}
+	})
+
+	t.Run("声明超出扫描范围", func(t *testing.T) {
+		late := strings.Repeat(" ", declarationScanSize) + gbkPage
+		file := write(t, "late.html", late)
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.DeclarationCount != 0 {
+			t.Errorf("Expected declaration beyond scan range to be kept, got %d", result.DeclarationCount)
+		}
+	})
+}
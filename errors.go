@@ -0,0 +1,124 @@
+package convertcontent2utf8
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 可用errors.Is判断的错误
+var (
+	ErrLowConfidence       = errors.New("detection confidence below threshold")
+	ErrBinaryFile          = errors.New("binary file")
+	ErrTooLarge            = errors.New("file too large")
+	ErrOutputExists        = errors.New("output file already exists")
+	ErrUnsupportedEncoding = errors.New("unsupported encoding")
+	ErrInvalidSequence     = errors.New("invalid byte sequence")
+	ErrUnmappable          = errors.New("character cannot be represented in target encoding")
+	ErrVerificationFailed  = errors.New("round-trip verification failed")
+	ErrModified            = errors.New("file modified since conversion")
+	ErrInvalidArgument     = errors.New("invalid argument")
+	ErrCommitFailed        = errors.New("transaction commit failed")
+	ErrWalkFailed          = errors.New("failed to collect files")
+)
+
+// 失败的操作，对应ConvertError.Op和FileError.Operation
+const (
+	OpRead          = "read"           // 读取或检查输入文件
+	OpDetect        = "detect"         // 检测编码
+	OpLowConfidence = "low_confidence" // 检测置信度低于阈值，批量中计为跳过
+	OpBinary        = "binary"         // 内容为二进制，批量中计为跳过
+	OpConvert       = "convert"        // 转换编码
+	OpOutputExists  = "output_exists"  // 输出文件已存在
+	OpBackup        = "backup"         // 备份
+	OpWrite         = "write"          // 写入输出
+	OpVerify        = "verify"         // 往返校验
+	OpJournal       = "journal"        // 写撤销日志
+	OpManifest      = "manifest"       // 更新增量清单
+	OpCommit        = "commit"         // 提交事务
+	OpTimeout       = "timeout"        // 单个文件超时
+	OpCancelled     = "cancelled"      // 整体被取消，不计为失败
+	OpUndo          = "undo"           // 撤销
+	OpRestore       = "restore"        // 从备份恢复
+	OpWalk          = "walk"           // 遍历目录
+	OpModified      = "modified"       // 文件在转换后被修改，拒绝撤销
+)
+
+// ConvertError 单个文件转换失败的详细信息，可用errors.As获取
+type ConvertError struct {
+	Path     string // 输入文件，内存和流式转换时为空
+	Op       string // 失败的操作
+	Encoding string // 检测到的源编码，检测前失败时为空
+	Err      error  // 原始错误
+}
+
+// opDescriptions 各操作失败时的描述
+var opDescriptions = map[string]string{
+	OpRead:          "failed to read",
+	OpDetect:        "failed to detect encoding",
+	OpLowConfidence: "skipped",
+	OpBinary:        "skipped",
+	OpConvert:       "failed to convert",
+	OpOutputExists:  "cannot write output",
+	OpBackup:        "failed to back up",
+	OpWrite:         "failed to write",
+	OpVerify:        "failed to verify",
+	OpJournal:       "failed to journal",
+	OpManifest:      "failed to update manifest",
+	OpCommit:        "failed to commit",
+	OpTimeout:       "conversion stopped",
+	OpCancelled:     "conversion stopped",
+	OpUndo:          "failed to undo",
+	OpRestore:       "failed to restore",
+	OpWalk:          "failed to walk",
+	OpModified:      "refused to undo",
+}
+
+func (e *ConvertError) Error() string {
+	description, ok := opDescriptions[e.Op]
+	if !ok {
+		description = "failed to " + e.Op
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("%s: %v", description, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", description, e.Path, e.Err)
+}
+
+func (e *ConvertError) Unwrap() error {
+	return e.Err
+}
+
+// encodingError 在内部错误上附带已检测到的源编码，构造ConvertError时取出
+type encodingError struct {
+	encoding string
+	err      error
+}
+
+func (e *encodingError) Error() string {
+	return e.err.Error()
+}
+
+func (e *encodingError) Unwrap() error {
+	return e.err
+}
+
+// withEncoding 为错误附带检测到的源编码
+func withEncoding(err error, encoding string) error {
+	if err == nil || encoding == "" {
+		return err
+	}
+	return &encodingError{encoding: encoding, err: err}
+}
+
+// newConvertError 构造ConvertError，取出内部附带的源编码
+func newConvertError(path, op string, err error) *ConvertError {
+	ce := &ConvertError{Path: path, Op: op, Err: err}
+	var withEnc *encodingError
+	if errors.As(err, &withEnc) {
+		ce.Encoding = withEnc.encoding
+		if err == error(withEnc) {
+			ce.Err = withEnc.err
+		}
+	}
+	return ce
+}
@@ -0,0 +1,171 @@
+package convertcontent2utf8
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvertError(t *testing.T) {
+	newFile := func(t *testing.T, content string) string {
+		file := filepath.Join(t.TempDir(), "data.txt")
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		return file
+	}
+
+	t.Run("低置信度", func(t *testing.T) {
+		file := newFile(t, gbkSample)
+
+		_, err := ConvertFile(file, file, WithOverwrite(true), WithMinConfidence(1.01))
+		if !errors.Is(err, ErrLowConfidence) {
+			t.Fatalf("Expected ErrLowConfidence, got %v", err)
+		}
+
+		var convertErr *ConvertError
+		if !errors.As(err, &convertErr) {
+			t.Fatalf("Expected *ConvertError, got %T", err)
+		}
+		if convertErr.Path != file {
+			t.Errorf("Expected Path %s, got %s", file, convertErr.Path)
+		}
+		if convertErr.Op != OpLowConfidence {
+			t.Errorf("Expected Op %s, got %s", OpLowConfidence, convertErr.Op)
+		}
+		if convertErr.Encoding == "" {
+			t.Error("Expected detected encoding to be recorded")
+		}
+	})
+
+	t.Run("输出已存在", func(t *testing.T) {
+		file := newFile(t, gbkSample)
+		outputFile := filepath.Join(filepath.Dir(file), "out.txt")
+		if err := os.WriteFile(outputFile, []byte("existing"), 0644); err != nil {
+			t.Fatalf("Failed to create output file: %v", err)
+		}
+
+		_, err := ConvertFile(file, outputFile, WithExistingPolicy(ExistingFail))
+		if !errors.Is(err, ErrOutputExists) {
+			t.Errorf("Expected ErrOutputExists, got %v", err)
+		}
+	})
+
+	t.Run("文件过大", func(t *testing.T) {
+		file := newFile(t, gbkSample)
+
+		_, err := ConvertFile(file, file, WithOverwrite(true), WithMaxFileSize(4))
+		if !errors.Is(err, ErrTooLarge) {
+			t.Errorf("Expected ErrTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("批量错误", func(t *testing.T) {
+		missing := filepath.Join(t.TempDir(), "missing.txt")
+
+		result, err := ConvertFiles([]string{missing})
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if len(result.Errors) != 1 {
+			t.Fatalf("Expected 1 error, got %d", len(result.Errors))
+		}
+
+		fileErr := result.Errors[0]
+		if !errors.Is(fileErr.Err, fs.ErrNotExist) {
+			t.Errorf("Expected fs.ErrNotExist, got %v", fileErr.Err)
+		}
+		var convertErr *ConvertError
+		if !errors.As(fileErr.Err, &convertErr) || convertErr.Op != OpRead {
+			t.Errorf("Expected *ConvertError with Op %s, got %v", OpRead, fileErr.Err)
+		}
+	})
+
+	t.Run("参数错误", func(t *testing.T) {
+		missing := filepath.Join(t.TempDir(), "missing.txt")
+
+		_, err := ConvertFile(missing, missing)
+		var convertErr *ConvertError
+		if !errors.As(err, &convertErr) || convertErr.Op != OpRead || convertErr.Path != missing {
+			t.Errorf("Expected *ConvertError with Op %s for %s, got %v", OpRead, missing, err)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expected fs.ErrNotExist, got %v", err)
+		}
+
+		_, err = ConvertFile("", missing)
+		if !errors.As(err, &convertErr) || !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("Expected *ConvertError wrapping ErrInvalidArgument for empty path, got %v", err)
+		}
+
+		_, err = ConvertFiles(nil)
+		if !errors.As(err, &convertErr) || !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("Expected *ConvertError wrapping ErrInvalidArgument for empty list, got %v", err)
+		}
+
+		_, err = ConvertDirectory(filepath.Join(filepath.Dir(missing), "missing"))
+		if !errors.As(err, &convertErr) || !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expected *ConvertError wrapping fs.ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("事务提交失败", func(t *testing.T) {
+		file := newFile(t, gbkSample)
+		// 备份目录是普通文件，提交时备份失败
+		backupDir := filepath.Join(filepath.Dir(file), "backups")
+		if err := os.WriteFile(backupDir, nil, 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+
+		result, err := ConvertFiles([]string{file}, WithOverwrite(true), WithBackupMode(BackupArchive), WithBackupDir(backupDir), WithTransaction(true))
+		var convertErr *ConvertError
+		if !errors.As(err, &convertErr) || convertErr.Op != OpCommit || !errors.Is(err, ErrCommitFailed) {
+			t.Fatalf("Expected *ConvertError with Op %s wrapping ErrCommitFailed, got %v", OpCommit, err)
+		}
+		if result.Committed {
+			t.Error("Expected Committed to be false")
+		}
+		if data, _ := os.ReadFile(file); string(data) != gbkSample {
+			t.Error("Expected file to be left unchanged")
+		}
+	})
+
+	t.Run("清单保存失败时仍返回结果", func(t *testing.T) {
+		file := newFile(t, gbkSample)
+		// 清单所在目录不存在，加载时视为空清单，保存时失败
+		manifest := filepath.Join(filepath.Dir(file), "missing", "manifest.json")
+
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithManifest(manifest))
+		var convertErr *ConvertError
+		if !errors.As(err, &convertErr) || convertErr.Op != OpManifest {
+			t.Fatalf("Expected *ConvertError with Op %s, got %v", OpManifest, err)
+		}
+		if result == nil || result.OutputAction == OutputUnchanged {
+			t.Errorf("Expected result of the written output, got %+v", result)
+		}
+	})
+
+	t.Run("内存转换", func(t *testing.T) {
+		_, _, err := ConvertBytes([]byte(gbkSample), WithMinConfidence(1.01))
+
+		var convertErr *ConvertError
+		if !errors.As(err, &convertErr) {
+			t.Fatalf("Expected *ConvertError, got %T", err)
+		}
+		if convertErr.Path != "" {
+			t.Errorf("Expected empty Path, got %s", convertErr.Path)
+		}
+		if !errors.Is(err, ErrLowConfidence) {
+			t.Errorf("Expected ErrLowConfidence, got %v", err)
+		}
+	})
+
+	t.Run("错误信息", func(t *testing.T) {
+		err := &ConvertError{Path: "a.txt", Op: OpWrite, Err: errors.New("disk full")}
+		if err.Error() != "failed to write a.txt: disk full" {
+			t.Errorf("Unexpected error message: %s", err.Error())
+		}
+	})
+}
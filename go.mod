@@ -2,9 +2,9 @@ module github.com/mirbf/ConvertContent2UTF8
 
 go 1.24.5
 
-require github.com/mirbf/encoding-processor v0.3.0
-
 require (
-	github.com/saintfish/chardet v0.0.0-20230101081208-5e3ef4b5456d // indirect
-	golang.org/x/text v0.27.0 // indirect
+	github.com/mirbf/encoding-processor v0.3.0
+	golang.org/x/text v0.27.0
 )
+
+require github.com/saintfish/chardet v0.0.0-20230101081208-5e3ef4b5456d // indirect
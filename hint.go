@@ -0,0 +1,153 @@
+package convertcontent2utf8
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	encoding "github.com/mirbf/encoding-processor"
+	"golang.org/x/text/transform"
+)
+
+// hintConfidence 数据能按提示编码无误解码、采用提示编码时的置信度下限
+const hintConfidence = 0.9
+
+// EncodingRule 按路径指定源编码的规则，按顺序匹配，第一条匹配的规则生效
+type EncodingRule struct {
+	// 路径模式，按"/"分段用path.Match匹配，"**"匹配任意多段
+	// 只需匹配路径末尾的若干段，如"big5/*.txt"匹配"/data/big5/a.txt"；以"/"开头时从路径开头匹配
+	Pattern  string
+	Encoding string // 源编码
+	Force    bool   // true时跳过检测直接使用该编码，false时作为检测的优先候选
+}
+
+// sourceHint 返回path适用的源编码和是否强制：先按规则表，再按SourceEncoding，最后按EncodingHint，都没有时返回空
+func (c *Config) sourceHint(file string) (string, bool) {
+	if file != "" {
+		for _, rule := range c.EncodingRules {
+			if matchPath(rule.Pattern, file) {
+				return rule.Encoding, rule.Force
+			}
+		}
+	}
+	if c.SourceEncoding != "" {
+		return c.SourceEncoding, true
+	}
+	return c.EncodingHint, false
+}
+
+// matchPath 判断路径是否匹配规则中的模式
+func matchPath(pattern, file string) bool {
+	pattern = filepath.ToSlash(pattern)
+	patterns := strings.Split(strings.Trim(pattern, "/"), "/")
+	segments := strings.Split(strings.TrimPrefix(filepath.ToSlash(filepath.Clean(file)), "/"), "/")
+
+	if strings.HasPrefix(pattern, "/") {
+		return matchSegments(patterns, segments)
+	}
+	for start := range segments {
+		if matchSegments(patterns, segments[start:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments 逐段匹配，"**"匹配零个或多个段
+func matchSegments(patterns, segments []string) bool {
+	if len(patterns) == 0 {
+		return len(segments) == 0
+	}
+	if patterns[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(patterns[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	ok, err := path.Match(patterns[0], segments[0])
+	return ok && err == nil && matchSegments(patterns[1:], segments[1:])
+}
+
+// detectSource 确定数据的源编码：带BOM时由BOM确定；强制编码时跳过检测；有提示编码时把它作为优先候选
+// 没有配置提示编码时，文件内声明的字符集作为检测置信度不高时的提示；truncated表示data只是前缀，末尾可能截断多字节字符
+func detectSource(config *Config, processor encoding.Processor, data []byte, file string, truncated bool) (*encoding.DetectionResult, BOM, error) {
+	if bom := sniffBOM(data); bom != BOMNone {
+		return bom.detection(), bom, nil
+	}
+
+	hint, force := config.sourceHint(file)
+	if hint != "" {
+		if _, err := lookupEncoding(hint); err != nil {
+			return nil, BOMNone, err
+		}
+	}
+	declared := false
+	if hint == "" && config.CharsetDeclarations {
+		hint = resolveCharset(declaredEncoding(formatFor(file), data))
+		declared = hint != ""
+	}
+	if force {
+		return &encoding.DetectionResult{Encoding: hint, Confidence: 1.0}, BOMNone, nil
+	}
+
+	detection, err := detectEncoding(processor, data)
+	if err != nil || hint == "" {
+		return detection, BOMNone, err
+	}
+	// 文件内的声明可能已过时，检测结果足够可信时以检测为准
+	if declared && detection.Confidence >= hintConfidence {
+		return detection, BOMNone, nil
+	}
+	return applyHint(detection, data, hint, truncated), BOMNone, nil
+}
+
+// applyHint 把提示编码作为先验：检测结果与提示一致时提高置信度；
+// 不一致时，除非数据是含非ASCII字符的合法UTF-8，只要样本能按提示编码无误解码就采用提示编码
+func applyHint(detection *encoding.DetectionResult, data []byte, hint string, truncated bool) *encoding.DetectionResult {
+	hinted := &encoding.DetectionResult{
+		Encoding:   hint,
+		Confidence: max(detection.Confidence, hintConfidence),
+	}
+	if sameEncoding(strings.ToUpper(detection.Encoding), strings.ToUpper(hint)) {
+		return hinted
+	}
+
+	if len(data) > detectionSampleSize {
+		data = data[:detectionSampleSize]
+		truncated = true
+	}
+	if isUTF8Name(detection.Encoding) && !strings.EqualFold(detection.Encoding, "ASCII") && decodesCleanly(detection.Encoding, data, truncated) {
+		return detection
+	}
+	if !decodesCleanly(hint, data, truncated) {
+		return detection
+	}
+	return hinted
+}
+
+// decodesCleanly 判断数据能否按指定编码无误解码，truncated时忽略末尾不完整的字符
+func decodesCleanly(name string, data []byte, truncated bool) bool {
+	t, err := newReplacingTranscoder(name, encoding.EncodingUTF8, ReplaceFail, LineEndingKeep, &replacementLog{})
+	if err != nil {
+		return false
+	}
+
+	buf := make([]byte, 4096)
+	for len(data) > 0 {
+		_, n, err := t.Transform(buf, data, !truncated)
+		data = data[n:]
+		switch err {
+		case nil, transform.ErrShortDst:
+		case transform.ErrShortSrc:
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package convertcontent2utf8
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		file     string
+		expected bool
+	}{
+		{"*.txt", "/data/a.txt", true},
+		{"*.txt", "/data/a.csv", false},
+		{"big5/*.txt", "/data/big5/a.txt", true},
+		{"big5/*.txt", "/data/gbk/a.txt", false},
+		{"big5/**/*.txt", "/data/big5/a/b/c.txt", true},
+		{"big5/**/*.txt", "/data/big5/c.txt", true},
+		{"/data/*.txt", "/data/a.txt", true},
+		{"/data/*.txt", "/other/data/a.txt", false},
+		{"legacy/**", "/data/legacy/a/b.txt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.file, func(t *testing.T) {
+			if got := matchPath(tt.pattern, filepath.FromSlash(tt.file)); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEncodingHint(t *testing.T) {
+	// Big5编码的"中文"，样本太短，检测结果置信度很低
+	big5 := "\xa4\xa4\xa4\xe5"
+
+	tests := []struct {
+		name       string
+		input      string
+		options    []Option
+		expected   string
+		encoding   string
+		confidence float64
+	}{
+		{"提示编码优先", big5, []Option{WithEncodingHint("BIG5")}, "中文", "BIG5", hintConfidence},
+		{"强制编码跳过检测", big5, []Option{WithSourceEncoding("BIG5")}, "中文", "BIG5", 1.0},
+		{"合法UTF-8不采用提示", "中文", []Option{WithEncodingHint("BIG5")}, "中文", "UTF-8", -1},
+		{"无法按提示编码解码时不采用", "\xd6\xd0\xff", []Option{WithEncodingHint("BIG5"), WithReplacementPolicy(ReplaceSubstitute)}, "", "GB18030", -1},
+		{"BOM优先于强制编码", "\xef\xbb\xbf中文", []Option{WithSourceEncoding("BIG5")}, "\xef\xbb\xbf中文", "UTF-8", 1.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := append([]Option{WithMinConfidence(0)}, tt.options...)
+			converted, result, err := ConvertBytes([]byte(tt.input), options...)
+			if err != nil {
+				t.Fatalf("ConvertBytes failed: %v", err)
+			}
+			if result.SourceEncoding != tt.encoding {
+				t.Errorf("Expected source encoding %s, got %s", tt.encoding, result.SourceEncoding)
+			}
+			if tt.expected != "" && string(converted) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(converted))
+			}
+			if tt.confidence >= 0 && result.DetectionConfidence != tt.confidence {
+				t.Errorf("Expected confidence %v, got %v", tt.confidence, result.DetectionConfidence)
+			}
+		})
+	}
+
+	t.Run("不支持的编码", func(t *testing.T) {
+		_, _, err := ConvertBytes([]byte(big5), WithSourceEncoding("EBCDIC"))
+		if !errors.Is(err, ErrUnsupportedEncoding) {
+			t.Errorf("Expected ErrUnsupportedEncoding, got %v", err)
+		}
+	})
+
+	t.Run("流式转换", func(t *testing.T) {
+		var out strings.Builder
+		result, err := ConvertReader(context.Background(), strings.NewReader(big5), &out, WithSourceEncoding("BIG5"))
+		if err != nil {
+			t.Fatalf("ConvertReader failed: %v", err)
+		}
+		if out.String() != "中文" || result.SourceEncoding != "BIG5" {
+			t.Errorf("Expected BIG5 conversion, got %q from %s", out.String(), result.SourceEncoding)
+		}
+	})
+
+	t.Run("强制编码时合法UTF-8的文件也要转换", func(t *testing.T) {
+		// UTF-8的"你好"按GBK解码为"浣犲ソ"
+		file := filepath.Join(t.TempDir(), "a.txt")
+		if err := os.WriteFile(file, []byte("你好"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithSourceEncoding("GBK"))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction == OutputUnchanged || result.SourceEncoding != "GBK" {
+			t.Errorf("Expected GBK conversion, got %s from %s", result.OutputAction, result.SourceEncoding)
+		}
+	})
+}
+
+func TestEncodingRules(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		"big5/a.txt": "\xa4\xa4\xa4\xe5",
+		"sjis/a.txt": "\x82\xa0\x82\xa2",
+		"gbk/a.txt":  "\xd6\xd0\xce\xc4",
+		"ascii.txt":  "plain text\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	result, err := ConvertDirectory(tempDir,
+		WithRecursive(true),
+		WithOverwrite(true),
+		WithBackup(false),
+		WithMinConfidence(0),
+		WithEncodingRules(
+			EncodingRule{Pattern: "big5/*.txt", Encoding: "BIG5"},
+			EncodingRule{Pattern: "sjis/**", Encoding: "SHIFT_JIS", Force: true},
+		),
+		WithSourceEncoding("GBK"),
+	)
+	if err != nil {
+		t.Fatalf("ConvertDirectory failed: %v", err)
+	}
+	if result.FailedFiles != 0 {
+		t.Fatalf("Expected no failures, got %+v", result.Errors)
+	}
+
+	expected := map[string]string{
+		"big5/a.txt": "中文",
+		"sjis/a.txt": "あい",
+		"gbk/a.txt":  "中文",
+		"ascii.txt":  "plain text\n",
+	}
+	for name, text := range expected {
+		content, _ := os.ReadFile(filepath.Join(tempDir, filepath.FromSlash(name)))
+		if string(content) != text {
+			t.Errorf("Expected %s to be %q, got %q", name, text, string(content))
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// JournalEntry 撤销日志中的一条改动记录
+type JournalEntry struct {
+	File         string       `json:"file"`                    // 被写入的文件
+	Action       OutputAction `json:"action"`                  // created/overwritten/renamed
+	Original     string       `json:"original,omitempty"`      // 原内容副本，新建的文件为空
+	OriginalHash string       `json:"original_hash,omitempty"` // 原内容的SHA-256
+	Mode         os.FileMode  `json:"mode,omitempty"`          // 原文件权限
+	NewHash      string       `json:"new_hash"`                // 写入后内容的SHA-256
+	Time         time.Time    `json:"time"`
+}
+
+// UndoResult 撤销结果
+type UndoResult struct {
+	Restored []string    `json:"restored"`         // 恢复了原内容的文件
+	Removed  []string    `json:"removed"`          // 删除的新建文件
+	Errors   []FileError `json:"errors,omitempty"` // 未能撤销的文件，仍保留在日志中
+}
+
+// journal 撤销日志，每行一条JSON记录，原内容副本保存在日志旁的数据目录中
+type journal struct {
+	path    string
+	dataDir string
+	file    *os.File
+	mutex   sync.Mutex
+}
+
+// journalDataDir 返回日志对应的原内容副本目录
+func journalDataDir(path string) string {
+	return path + ".data"
+}
+
+// isJournalPath 判断路径是否为撤销日志或其副本目录，遍历目录时跳过
+func (c *Config) isJournalPath(path string) bool {
+	if c.JournalPath == "" {
+		return false
+	}
+	key := manifestKey(path)
+	return key == manifestKey(c.JournalPath) || key == manifestKey(journalDataDir(c.JournalPath))
+}
+
+// openJournal 按配置打开撤销日志，追加写入；未启用或试运行时返回nil
+func openJournal(config *Config) (*journal, error) {
+	if config.JournalPath == "" || config.DryRun {
+		return nil, nil
+	}
+
+	dataDir := journalDataDir(config.JournalPath)
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal data directory: %w", err)
+	}
+	f, err := os.OpenFile(config.JournalPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	return &journal{path: config.JournalPath, dataDir: dataDir, file: f}, nil
+}
+
+// close 关闭日志
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// snapshot 在写入前保存即将被覆盖的原内容，返回待提交的记录
+func (j *journal) snapshot(file string, action OutputAction) (*JournalEntry, error) {
+	if j == nil {
+		return nil, nil
+	}
+
+	entry := &JournalEntry{File: file, Action: action}
+	if action != OutputOverwritten {
+		return entry, nil
+	}
+
+	src, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := os.CreateTemp(j.dataDir, "*-"+filepath.Base(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal copy: %w", err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(dst, h), src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return nil, fmt.Errorf("failed to copy %s into journal: %w", file, err)
+	}
+
+	entry.Original = dst.Name()
+	entry.OriginalHash = hex.EncodeToString(h.Sum(nil))
+	entry.Mode = info.Mode().Perm()
+	return entry, nil
+}
+
+// discard 写入失败时丢弃记录和原内容副本
+func (j *journal) discard(entry *JournalEntry) {
+	if j == nil || entry == nil || entry.Original == "" {
+		return
+	}
+	os.Remove(entry.Original)
+}
+
+// commit 写入成功后记录新内容的哈希并追加到日志，同步到磁盘
+func (j *journal) commit(entry *JournalEntry, written string) error {
+	if j == nil {
+		return nil
+	}
+
+	hash, err := hashFile(written)
+	if err != nil {
+		return err
+	}
+	entry.File = written
+	entry.NewHash = hash
+	entry.Time = time.Now()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return j.file.Sync()
+}
+
+// Undo 按撤销日志从新到旧恢复被改写的文件，删除新建的文件
+// 转换后又被修改过的文件拒绝恢复；撤销成功的记录从日志中移除，全部成功时删除日志和副本目录
+func Undo(journalPath string) (*UndoResult, error) {
+	entries, err := readJournal(journalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UndoResult{
+		Restored: make([]string, 0),
+		Removed:  make([]string, 0),
+	}
+	var remaining []*JournalEntry
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		operation, err := undoEntry(entry)
+		if err != nil {
+			result.Errors = append(result.Errors, FileError{
+				File:      entry.File,
+				Operation: operation,
+				Error:     err.Error(),
+				Err:       newConvertError(entry.File, operation, err),
+				Timestamp: time.Now(),
+			})
+			remaining = append([]*JournalEntry{entry}, remaining...)
+			continue
+		}
+
+		if entry.Action == OutputOverwritten {
+			result.Restored = append(result.Restored, entry.File)
+			os.Remove(entry.Original)
+		} else {
+			result.Removed = append(result.Removed, entry.File)
+		}
+	}
+
+	if len(remaining) == 0 {
+		if err := os.Remove(journalPath); err != nil {
+			return result, fmt.Errorf("failed to remove journal: %w", err)
+		}
+		os.RemoveAll(journalDataDir(journalPath))
+		return result, nil
+	}
+
+	if err := writeJournal(journalPath, remaining); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// undoEntry 撤销一条记录，失败时返回操作名称
+func undoEntry(entry *JournalEntry) (string, error) {
+	current, err := hashFile(entry.File)
+	if err != nil {
+		return OpUndo, err
+	}
+	if current != entry.NewHash {
+		return OpModified, fmt.Errorf("%w: %s", ErrModified, entry.File)
+	}
+
+	if entry.Action != OutputOverwritten {
+		return OpUndo, os.Remove(entry.File)
+	}
+
+	hash, err := hashFile(entry.Original)
+	if err != nil {
+		return OpUndo, fmt.Errorf("original copy is not accessible: %w", err)
+	}
+	if hash != entry.OriginalHash {
+		return OpUndo, fmt.Errorf("original copy %s is corrupted", entry.Original)
+	}
+
+	mode := entry.Mode
+	if mode == 0 {
+		mode = defaultFileMode
+	}
+	restore := func(w io.Writer) error {
+		src, err := os.Open(entry.Original)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(w, src)
+		return err
+	}
+	if err := writeFileAtomic(entry.File, mode, restore, nil); err != nil {
+		return OpUndo, err
+	}
+	return "", nil
+}
+
+// readJournal 读取撤销日志中的全部记录
+func readJournal(path string) ([]*JournalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	defer f.Close()
+
+	var entries []*JournalEntry
+	decoder := json.NewDecoder(f)
+	for {
+		entry := &JournalEntry{}
+		err := decoder.Decode(entry)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid journal entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// writeJournal 用给定记录原子地重写撤销日志
+func writeJournal(path string, entries []*JournalEntry) error {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := writeFileAtomic(path, 0644, writeBytes(buf.Bytes()), nil); err != nil {
+		return fmt.Errorf("failed to rewrite journal: %w", err)
+	}
+	return nil
+}
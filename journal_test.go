@@ -0,0 +1,122 @@
+package convertcontent2utf8
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	setup := func(t *testing.T) (string, string) {
+		testDir := t.TempDir()
+		file := filepath.Join(testDir, "data.txt")
+		if err := os.WriteFile(file, []byte(gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		return file, filepath.Join(testDir, "undo.journal")
+	}
+
+	assertContent := func(t *testing.T, file, expected string) {
+		t.Helper()
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(data) != expected {
+			t.Errorf("Expected content %q, got %q", expected, string(data))
+		}
+	}
+
+	t.Run("撤销原地转换", func(t *testing.T) {
+		file, journalPath := setup(t)
+
+		result, err := ConvertDirectory(filepath.Dir(file),
+			WithOverwrite(true),
+			WithBackup(false),
+			WithJournal(journalPath),
+		)
+		if err != nil {
+			t.Fatalf("ConvertDirectory failed: %v", err)
+		}
+		if result.SuccessfulFiles != 1 {
+			t.Fatalf("Expected SuccessfulFiles 1, got %d", result.SuccessfulFiles)
+		}
+		assertContent(t, file, gbkSampleText)
+
+		undo, err := Undo(journalPath)
+		if err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+		if len(undo.Restored) != 1 || undo.Restored[0] != file {
+			t.Errorf("Expected %s to be restored, got %v", file, undo.Restored)
+		}
+		assertContent(t, file, gbkSample)
+
+		if _, err := os.Stat(journalPath); !os.IsNotExist(err) {
+			t.Error("Expected journal to be removed after a complete undo")
+		}
+		if _, err := os.Stat(journalDataDir(journalPath)); !os.IsNotExist(err) {
+			t.Error("Expected journal data directory to be removed after a complete undo")
+		}
+	})
+
+	t.Run("删除新建的输出文件", func(t *testing.T) {
+		file, journalPath := setup(t)
+		outputFile := filepath.Join(filepath.Dir(file), "out.txt")
+
+		if _, err := ConvertFile(file, outputFile, WithJournal(journalPath)); err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+
+		undo, err := Undo(journalPath)
+		if err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+		if len(undo.Removed) != 1 {
+			t.Errorf("Expected 1 removed file, got %d", len(undo.Removed))
+		}
+		if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+			t.Error("Expected created output file to be removed")
+		}
+		assertContent(t, file, gbkSample)
+	})
+
+	t.Run("拒绝恢复转换后被修改的文件", func(t *testing.T) {
+		file, journalPath := setup(t)
+
+		if _, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithJournal(journalPath)); err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if err := os.WriteFile(file, []byte("edited"), 0644); err != nil {
+			t.Fatalf("Failed to modify file: %v", err)
+		}
+
+		undo, err := Undo(journalPath)
+		if err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+		if len(undo.Errors) != 1 || undo.Errors[0].Operation != "modified" {
+			t.Fatalf("Expected a modified error, got %+v", undo.Errors)
+		}
+		assertContent(t, file, "edited")
+
+		entries, err := readJournal(journalPath)
+		if err != nil {
+			t.Fatalf("readJournal failed: %v", err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("Expected the refused entry to remain in the journal, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("试运行不记录", func(t *testing.T) {
+		file, journalPath := setup(t)
+
+		if _, err := ConvertFile(file, file, WithOverwrite(true), WithDryRun(true), WithJournal(journalPath)); err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if _, err := os.Stat(journalPath); !os.IsNotExist(err) {
+			t.Error("Dry run should not create a journal")
+		}
+	})
+}
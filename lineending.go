@@ -0,0 +1,183 @@
+package convertcontent2utf8
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	encoding "github.com/mirbf/encoding-processor"
+	"golang.org/x/text/transform"
+)
+
+// LineEnding 换行符处理方式，在转码的同一遍中完成
+type LineEnding string
+
+const (
+	LineEndingKeep   LineEnding = "keep"   // 保持原样
+	LineEndingLF     LineEnding = "lf"     // 统一为LF
+	LineEndingCRLF   LineEnding = "crlf"   // 统一为CRLF
+	LineEndingNative LineEnding = "native" // 统一为当前系统的换行符，Windows为CRLF，其他系统为LF
+)
+
+// LineEndingCounts 输入中各种换行符的数量
+type LineEndingCounts struct {
+	LF   int `json:"lf"`
+	CRLF int `json:"crlf"`
+	CR   int `json:"cr"` // 单独的CR（旧版Mac）
+}
+
+// Mixed 判断是否混用了多种换行符
+func (c LineEndingCounts) Mixed() bool {
+	kinds := 0
+	for _, n := range []int{c.LF, c.CRLF, c.CR} {
+		if n > 0 {
+			kinds++
+		}
+	}
+	return kinds > 1
+}
+
+// conforms 判断统计到的换行符是否都已是newline，newline为空时总是成立
+func (c LineEndingCounts) conforms(newline string) bool {
+	switch newline {
+	case "\n":
+		return c.CRLF == 0 && c.CR == 0
+	case "\r\n":
+		return c.LF == 0 && c.CR == 0
+	}
+	return true
+}
+
+// newlineFor 返回换行方式对应的换行符，保持原样时为空
+func newlineFor(ending LineEnding) (string, error) {
+	switch ending {
+	case LineEndingKeep, "":
+		return "", nil
+	case LineEndingLF:
+		return "\n", nil
+	case LineEndingCRLF:
+		return "\r\n", nil
+	case LineEndingNative:
+		if runtime.GOOS == "windows" {
+			return "\r\n", nil
+		}
+		return "\n", nil
+	}
+	return "", fmt.Errorf("unknown line ending: %s", ending)
+}
+
+// lineEndingCounter 统计读取的UTF-8数据中的换行符，读取结束后调用finish
+type lineEndingCounter struct {
+	reader  io.Reader
+	counts  LineEndingCounts
+	afterCR bool
+}
+
+func (c *lineEndingCounter) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	for _, b := range p[:n] {
+		switch {
+		case b == '\n' && c.afterCR:
+			c.counts.CRLF++
+		case b == '\n':
+			c.counts.LF++
+		case c.afterCR:
+			c.counts.CR++
+		}
+		c.afterCR = b == '\r'
+	}
+	return n, err
+}
+
+// finish 计入末尾单独的CR
+func (c *lineEndingCounter) finish() LineEndingCounts {
+	if c.afterCR {
+		c.afterCR = false
+		c.counts.CR++
+	}
+	return c.counts
+}
+
+// newlineNormalizer 在源编码的数据中把CRLF和CR统一为LF，用于往返校验时忽略换行符的差异
+// 按编码单元处理：UTF-16/32按2/4字节，其他支持的编码中CR和LF字节不会出现在多字节字符内部，按单字节处理
+type newlineNormalizer struct {
+	width     int
+	bigEndian bool
+}
+
+// newNewlineNormalizer 创建源编码对应的换行符归一化器
+func newNewlineNormalizer(name string) *newlineNormalizer {
+	switch strings.ToUpper(name) {
+	case encoding.EncodingUTF16, encoding.EncodingUTF16BE:
+		return &newlineNormalizer{width: 2, bigEndian: true}
+	case encoding.EncodingUTF16LE:
+		return &newlineNormalizer{width: 2}
+	case encoding.EncodingUTF32, encoding.EncodingUTF32BE:
+		return &newlineNormalizer{width: 4, bigEndian: true}
+	case encoding.EncodingUTF32LE:
+		return &newlineNormalizer{width: 4}
+	}
+	return &newlineNormalizer{width: 1}
+}
+
+// unit 读取一个编码单元的值
+func (n *newlineNormalizer) unit(b []byte) uint32 {
+	var v uint32
+	for i := 0; i < n.width; i++ {
+		if n.bigEndian {
+			v = v<<8 | uint32(b[i])
+		} else {
+			v |= uint32(b[i]) << (8 * i)
+		}
+	}
+	return v
+}
+
+// Reset 实现transform.Transformer，归一化器没有状态
+func (n *newlineNormalizer) Reset() {}
+
+// Transform 实现transform.Transformer
+func (n *newlineNormalizer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	w := n.width
+	for nSrc+w <= len(src) {
+		if nDst+w > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		unit := src[nSrc : nSrc+w]
+		size := w
+		if n.unit(unit) == '\r' {
+			// CR后是否紧跟LF要看下一个单元
+			if nSrc+2*w > len(src) && !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			if nSrc+2*w <= len(src) && n.unit(src[nSrc+w:]) == '\n' {
+				size = 2 * w
+			}
+			// 写出LF：CR单元中值为'\r'的字节换成'\n'
+			for i := 0; i < w; i++ {
+				dst[nDst+i] = unit[i]
+				if unit[i] == '\r' {
+					dst[nDst+i] = '\n'
+				}
+			}
+		} else {
+			copy(dst[nDst:], unit)
+		}
+		nDst += w
+		nSrc += size
+	}
+
+	// 末尾不完整的编码单元原样保留
+	if rest := len(src) - nSrc; rest > 0 {
+		if !atEOF {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		if nDst+rest > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], src[nSrc:])
+		nSrc = len(src)
+	}
+	return nDst, nSrc, nil
+}
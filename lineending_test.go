@@ -0,0 +1,169 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/text/transform"
+)
+
+func TestLineEnding(t *testing.T) {
+	// GBK编码的"中"
+	zhong := "\xd6\xd0"
+
+	tests := []struct {
+		name     string
+		input    string
+		options  []Option
+		expected string
+		counts   LineEndingCounts
+	}{
+		{"CRLF统一为LF", zhong + "\r\n" + zhong + "\r\n", []Option{WithLineEnding(LineEndingLF)}, "中\n中\n", LineEndingCounts{CRLF: 2}},
+		{"混用统一为LF", "a\r\nb\rc\nd", []Option{WithLineEnding(LineEndingLF)}, "a\nb\nc\nd", LineEndingCounts{LF: 1, CRLF: 1, CR: 1}},
+		{"统一为CRLF", "a\nb\rc\r\n", []Option{WithLineEnding(LineEndingCRLF)}, "a\r\nb\r\nc\r\n", LineEndingCounts{LF: 1, CRLF: 1, CR: 1}},
+		{"末尾单独的CR", "a\r\rb\r", []Option{WithLineEnding(LineEndingLF)}, "a\n\nb\n", LineEndingCounts{CR: 3}},
+		{"保持原样时只统计", "a\r\nb\rc\n", nil, "a\r\nb\rc\n", LineEndingCounts{LF: 1, CRLF: 1, CR: 1}},
+		{"UTF-16LE源", "\xff\xfea\x00\r\x00\n\x00b\x00", []Option{WithLineEnding(LineEndingLF)}, "\xef\xbb\xbfa\nb", LineEndingCounts{CRLF: 1}},
+		{"UTF-16LE目标", "a\nb", []Option{WithLineEnding(LineEndingCRLF), WithTargetEncoding("UTF-16LE")}, "a\x00\r\x00\n\x00b\x00", LineEndingCounts{LF: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := append([]Option{WithMinConfidence(0)}, tt.options...)
+			converted, result, err := ConvertBytes([]byte(tt.input), options...)
+			if err != nil {
+				t.Fatalf("ConvertBytes failed: %v", err)
+			}
+			if string(converted) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(converted))
+			}
+			if result.LineEndings != tt.counts {
+				t.Errorf("Expected counts %+v, got %+v", tt.counts, result.LineEndings)
+			}
+		})
+	}
+
+	t.Run("未知换行方式", func(t *testing.T) {
+		if _, _, err := ConvertBytes([]byte("a\n"), WithLineEnding("unix")); err == nil {
+			t.Error("Expected error for unknown line ending")
+		}
+	})
+
+	t.Run("混用判断", func(t *testing.T) {
+		if (LineEndingCounts{LF: 3}).Mixed() {
+			t.Error("Expected LF only not to be mixed")
+		}
+		if !(LineEndingCounts{LF: 1, CRLF: 1}).Mixed() {
+			t.Error("Expected LF and CRLF to be mixed")
+		}
+	})
+
+	t.Run("CRLF跨读取边界", func(t *testing.T) {
+		input := strings.Repeat(gbkSample+"\r\n", 10)
+		log := &replacementLog{}
+
+		config := getDefaultConfig()
+		config.LineEnding = LineEndingLF
+
+		var out bytes.Buffer
+		_, _, err := transcodeStream(context.Background(), config, iotest.OneByteReader(strings.NewReader(input)), &out, "GBK", "", log)
+		if err != nil {
+			t.Fatalf("transcodeStream failed: %v", err)
+		}
+		expected := strings.Repeat(gbkSampleText+"\n", 10)
+		if out.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, out.String())
+		}
+		if log.endings != (LineEndingCounts{CRLF: 10}) {
+			t.Errorf("Expected 10 CRLF, got %+v", log.endings)
+		}
+	})
+
+	t.Run("已是UTF-8但换行符需统一时改写", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "crlf.txt")
+		if err := os.WriteFile(file, []byte("a\r\nb\r\n"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputUnchanged || result.LineEndings.CRLF != 2 {
+			t.Errorf("Expected unchanged file with 2 CRLF, got %s, %+v", result.OutputAction, result.LineEndings)
+		}
+
+		result, err = ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithLineEnding(LineEndingLF))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputOverwritten {
+			t.Errorf("Expected overwrite, got %s", result.OutputAction)
+		}
+		content, _ := os.ReadFile(file)
+		if string(content) != "a\nb\n" {
+			t.Errorf("Expected LF endings, got %q", string(content))
+		}
+	})
+
+	t.Run("流式转换并校验", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "gbk.txt")
+		input := strings.Repeat(gbkSample+"\r\n", 100)
+		if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file,
+			WithOverwrite(true),
+			WithBackup(false),
+			WithStreamThreshold(1),
+			WithVerify(true),
+			WithLineEnding(LineEndingLF),
+		)
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.Verification != VerifyPassed {
+			t.Errorf("Expected verification to pass, got %s", result.Verification)
+		}
+		if result.LineEndings.CRLF != 100 {
+			t.Errorf("Expected 100 CRLF, got %+v", result.LineEndings)
+		}
+		content, _ := os.ReadFile(file)
+		if string(content) != strings.Repeat(gbkSampleText+"\n", 100) {
+			t.Error("Expected LF endings after streamed conversion")
+		}
+	})
+}
+
+func TestNewlineNormalizer(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		input    string
+		expected string
+	}{
+		{"单字节", "GBK", "\xd6\xd0\r\n\xd6\xd0\r", "\xd6\xd0\n\xd6\xd0\n"},
+		{"UTF-16LE", "UTF-16LE", "a\x00\r\x00\n\x00\r\x00b\x00", "a\x00\n\x00\n\x00b\x00"},
+		{"UTF-16BE", "UTF-16BE", "\x00a\x00\r\x00\n", "\x00a\x00\n"},
+		{"UTF-16中含0x0D字节的字符", "UTF-16LE", "\r\x01\n\x00", "\r\x01\n\x00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := transform.NewReader(iotest.OneByteReader(strings.NewReader(tt.input)), newNewlineNormalizer(tt.encoding))
+			var out bytes.Buffer
+			if _, err := out.ReadFrom(reader); err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, out.String())
+			}
+		})
+	}
+}
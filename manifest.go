@@ -0,0 +1,247 @@
+package convertcontent2utf8
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// manifestVersion 清单文件格式版本
+const manifestVersion = 1
+
+// ManifestEntry 清单中一个已成功处理文件的记录
+// Size、ModTime和Hash为处理完成后输入文件的指纹
+type ManifestEntry struct {
+	Path           string       `json:"path"`
+	OutputFile     string       `json:"output_file"`
+	Size           int64        `json:"size"`
+	ModTime        time.Time    `json:"mod_time"`
+	Hash           string       `json:"hash"` // 内容的SHA-256
+	SourceEncoding string       `json:"source_encoding"`
+	TargetEncoding string       `json:"target_encoding"`
+	Outcome        OutputAction `json:"outcome"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// Manifest 增量模式的处理清单，记录已成功处理文件的指纹，可并发使用
+type Manifest struct {
+	path    string
+	entries map[string]*ManifestEntry
+	mutex   sync.Mutex
+	saving  sync.Mutex // 串行化保存，保证后取的快照后写入
+}
+
+// manifestFile 清单文件的JSON结构
+type manifestFile struct {
+	Version int                       `json:"version"`
+	Entries map[string]*ManifestEntry `json:"entries"`
+}
+
+// LoadManifest 加载清单文件，文件不存在时返回空清单
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{path: path, entries: make(map[string]*ManifestEntry)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var file manifestFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if file.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d in %s", file.Version, path)
+	}
+	if file.Entries != nil {
+		m.entries = file.Entries
+	}
+	return m, nil
+}
+
+// Save 原子写入清单文件
+func (m *Manifest) Save() error {
+	m.saving.Lock()
+	defer m.saving.Unlock()
+
+	m.mutex.Lock()
+	data, err := json.MarshalIndent(manifestFile{Version: manifestVersion, Entries: m.entries}, "", "  ")
+	m.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(m.path, defaultFileMode, writeBytes(data), nil); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return nil
+}
+
+// Entries 返回按路径排序的全部记录
+func (m *Manifest) Entries() []ManifestEntry {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entries := make([]ManifestEntry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// Prune 删除文件已不存在的记录，返回被删除的路径
+func (m *Manifest) Prune() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var removed []string
+	for key, entry := range m.entries {
+		if _, err := os.Stat(entry.Path); os.IsNotExist(err) {
+			delete(m.entries, key)
+			removed = append(removed, entry.Path)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// Reset 清空全部记录
+func (m *Manifest) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.entries = make(map[string]*ManifestEntry)
+}
+
+// loadManifest 按配置加载清单，未启用增量模式时返回nil
+func loadManifest(config *Config) (*Manifest, error) {
+	if config.ManifestPath == "" || config.DryRun {
+		return nil, nil
+	}
+	return LoadManifest(config.ManifestPath)
+}
+
+// save 保存清单，未启用时不做任何事
+func (m *Manifest) save() error {
+	if m == nil {
+		return nil
+	}
+	return m.Save()
+}
+
+// upToDate 文件自上次成功处理后未变化时返回对应的结果，否则返回nil
+// 大小和修改时间都相同即视为未变化；仅修改时间不同时比较内容哈希
+func (m *Manifest) upToDate(config *Config, inputFile, outputFile string) *ConvertResult {
+	if m == nil {
+		return nil
+	}
+
+	key := manifestKey(inputFile)
+	m.mutex.Lock()
+	entry, ok := m.entries[key]
+	m.mutex.Unlock()
+	if !ok || entry.TargetEncoding != config.TargetEncoding || entry.OutputFile != manifestKey(outputFile) {
+		return nil
+	}
+
+	info, err := os.Stat(inputFile)
+	if err != nil || info.Size() != entry.Size {
+		return nil
+	}
+	if _, err := os.Stat(outputFile); err != nil {
+		return nil
+	}
+	if !info.ModTime().Equal(entry.ModTime) {
+		hash, err := hashFile(inputFile)
+		if err != nil || hash != entry.Hash {
+			return nil
+		}
+		// 内容未变，仅修改时间变化，更新记录避免下次再计算哈希
+		m.mutex.Lock()
+		entry.ModTime = info.ModTime()
+		m.mutex.Unlock()
+	}
+
+	return &ConvertResult{
+		InputFile:      inputFile,
+		OutputFile:     outputFile,
+		SourceEncoding: entry.SourceEncoding,
+		TargetEncoding: entry.TargetEncoding,
+		Changed:        false,
+		OutputAction:   OutputUpToDate,
+	}
+}
+
+// record 记录成功处理的文件，跳过、试运行和未启用时不记录
+// outputFile为请求的输出路径，改名策略下与实际写入的路径不同
+func (m *Manifest) record(inputFile, outputFile string, result *ConvertResult) error {
+	if m == nil || result.DryRun {
+		return nil
+	}
+	switch result.OutputAction {
+	case OutputSkipped, OutputUpToDate:
+		return nil
+	}
+
+	info, err := os.Stat(inputFile)
+	if err != nil {
+		return err
+	}
+	hash, err := hashFile(inputFile)
+	if err != nil {
+		return err
+	}
+
+	entry := &ManifestEntry{
+		Path:           manifestKey(inputFile),
+		OutputFile:     manifestKey(outputFile),
+		Size:           info.Size(),
+		ModTime:        info.ModTime(),
+		Hash:           hash,
+		SourceEncoding: result.SourceEncoding,
+		TargetEncoding: result.TargetEncoding,
+		Outcome:        result.OutputAction,
+		UpdatedAt:      time.Now(),
+	}
+
+	m.mutex.Lock()
+	m.entries[entry.Path] = entry
+	m.mutex.Unlock()
+	return nil
+}
+
+// manifestKey 清单使用绝对路径作为键，不同工作目录下的运行可以共用清单
+func manifestKey(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// hashFile 计算文件内容的SHA-256
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,210 @@
+package convertcontent2utf8
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManifest(t *testing.T) {
+	setup := func(t *testing.T) (string, string) {
+		testDir := t.TempDir()
+		file := filepath.Join(testDir, "data.txt")
+		if err := os.WriteFile(file, []byte(gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		return file, filepath.Join(testDir, "manifest.json")
+	}
+
+	options := func(manifest string) []Option {
+		return []Option{WithOverwrite(true), WithBackup(false), WithManifest(manifest)}
+	}
+
+	t.Run("记录并跳过未变化的文件", func(t *testing.T) {
+		file, manifestPath := setup(t)
+
+		result, err := ConvertFiles([]string{file}, options(manifestPath)...)
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if result.SuccessfulFiles != 1 {
+			t.Fatalf("Expected SuccessfulFiles 1, got %d", result.SuccessfulFiles)
+		}
+
+		manifest, err := LoadManifest(manifestPath)
+		if err != nil {
+			t.Fatalf("LoadManifest failed: %v", err)
+		}
+		entries := manifest.Entries()
+		if len(entries) != 1 {
+			t.Fatalf("Expected 1 manifest entry, got %d", len(entries))
+		}
+		if entries[0].SourceEncoding == "" || entries[0].Hash == "" || entries[0].Outcome != OutputOverwritten {
+			t.Errorf("Unexpected manifest entry: %+v", entries[0])
+		}
+
+		var statuses []ProgressStatus
+		opts := append(options(manifestPath), WithProgress(func(p Progress) {
+			statuses = append(statuses, p.Status)
+		}))
+		result, err = ConvertFiles([]string{file}, opts...)
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if result.SkippedFiles != 1 {
+			t.Errorf("Expected SkippedFiles 1, got %d", result.SkippedFiles)
+		}
+		if result.Results[0].OutputAction != OutputUpToDate {
+			t.Errorf("Expected OutputAction %s, got %s", OutputUpToDate, result.Results[0].OutputAction)
+		}
+		if last := statuses[len(statuses)-1]; last != StatusUpToDate {
+			t.Errorf("Expected final status %s, got %s", StatusUpToDate, last)
+		}
+	})
+
+	t.Run("仅修改时间变化", func(t *testing.T) {
+		file, manifestPath := setup(t)
+		if _, err := ConvertFile(file, file, options(manifestPath)...); err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatalf("Failed to set file times: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, options(manifestPath)...)
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputUpToDate {
+			t.Errorf("Expected OutputAction %s, got %s", OutputUpToDate, result.OutputAction)
+		}
+	})
+
+	t.Run("内容变化后重新处理", func(t *testing.T) {
+		file, manifestPath := setup(t)
+		if _, err := ConvertFile(file, file, options(manifestPath)...); err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+
+		if err := os.WriteFile(file, []byte(gbkSample+gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to modify file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, options(manifestPath)...)
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputOverwritten {
+			t.Errorf("Expected OutputAction %s, got %s", OutputOverwritten, result.OutputAction)
+		}
+	})
+
+	t.Run("试运行不写清单", func(t *testing.T) {
+		file, manifestPath := setup(t)
+		if _, err := ConvertFile(file, file, append(options(manifestPath), WithDryRun(true))...); err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if _, err := os.Stat(manifestPath); !os.IsNotExist(err) {
+			t.Error("Dry run should not create a manifest")
+		}
+	})
+
+	t.Run("清理和重置", func(t *testing.T) {
+		file, manifestPath := setup(t)
+		other := filepath.Join(filepath.Dir(file), "other.txt")
+		if err := os.WriteFile(other, []byte(gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if _, err := ConvertFiles([]string{file, other}, options(manifestPath)...); err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+
+		if err := os.Remove(other); err != nil {
+			t.Fatalf("Failed to remove file: %v", err)
+		}
+		manifest, err := LoadManifest(manifestPath)
+		if err != nil {
+			t.Fatalf("LoadManifest failed: %v", err)
+		}
+		removed := manifest.Prune()
+		if len(removed) != 1 || filepath.Base(removed[0]) != "other.txt" {
+			t.Errorf("Expected other.txt to be pruned, got %v", removed)
+		}
+		if len(manifest.Entries()) != 1 {
+			t.Errorf("Expected 1 remaining entry, got %d", len(manifest.Entries()))
+		}
+
+		manifest.Reset()
+		if err := manifest.Save(); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		manifest, err = LoadManifest(manifestPath)
+		if err != nil {
+			t.Fatalf("LoadManifest failed: %v", err)
+		}
+		if len(manifest.Entries()) != 0 {
+			t.Errorf("Expected empty manifest after reset, got %d entries", len(manifest.Entries()))
+		}
+	})
+
+	t.Run("清单损坏时不泄漏协程", func(t *testing.T) {
+		file, manifestPath := setup(t)
+		if err := os.WriteFile(manifestPath, []byte("{not json"), 0644); err != nil {
+			t.Fatalf("Failed to create manifest: %v", err)
+		}
+
+		before := runtime.NumGoroutine()
+		for i := 0; i < 5; i++ {
+			if _, err := ConvertFiles([]string{file}, options(manifestPath)...); err == nil {
+				t.Fatal("Expected error for malformed manifest")
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if after := runtime.NumGoroutine(); after > before {
+			t.Errorf("Expected no leaked goroutines, got %d before and %d after", before, after)
+		}
+	})
+
+	t.Run("并发转换不丢失记录", func(t *testing.T) {
+		_, manifestPath := setup(t)
+		dir := filepath.Dir(manifestPath)
+		converter := NewConverter(options(manifestPath)...)
+
+		const count = 40
+		var wg sync.WaitGroup
+		errs := make(chan error, count)
+		for i := 0; i < count; i++ {
+			file := filepath.Join(dir, fmt.Sprintf("data%02d.txt", i))
+			if err := os.WriteFile(file, []byte(gbkSample), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := converter.ConvertFile(context.Background(), file, file); err != nil {
+					errs <- err
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("ConvertFile failed: %v", err)
+		}
+
+		manifest, err := LoadManifest(manifestPath)
+		if err != nil {
+			t.Fatalf("LoadManifest failed: %v", err)
+		}
+		if n := len(manifest.Entries()); n != count {
+			t.Errorf("Expected %d manifest entries, got %d", count, n)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package convertcontent2utf8
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// defaultFileMode 不保留权限时输出文件使用的权限
+const defaultFileMode os.FileMode = 0644
+
+// errUnsupported 当前平台不支持的元数据操作
+var errUnsupported = errors.New("not supported on this platform")
+
+// fileMetadata 转换前捕获的源文件元数据
+type fileMetadata struct {
+	info      os.FileInfo
+	xattrs    map[string][]byte
+	xattrsErr error
+}
+
+// captureMetadata 捕获源文件元数据，扩展属性仅在启用时读取
+func captureMetadata(config *Config, path string) (*fileMetadata, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &fileMetadata{info: info}
+	if config.PreserveXattrs {
+		meta.xattrs, meta.xattrsErr = readXattrs(path)
+	}
+	return meta, nil
+}
+
+// perm 返回输出文件应使用的权限
+func (m *fileMetadata) perm(config *Config) os.FileMode {
+	if m == nil || !config.PreserveMode {
+		return defaultFileMode
+	}
+	return m.info.Mode().Perm()
+}
+
+// apply 将元数据应用到文件，尽力而为，未能保留的项目记录在结果中
+func (m *fileMetadata) apply(config *Config, path string) *MetadataResult {
+	if m == nil || !(config.PreserveMode || config.PreserveTimes || config.PreserveOwner || config.PreserveXattrs) {
+		return nil
+	}
+
+	result := &MetadataResult{}
+	fail := func(item string, err error) {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", item, err))
+	}
+
+	if config.PreserveMode {
+		if err := os.Chmod(path, m.info.Mode().Perm()); err != nil {
+			fail("mode", err)
+		} else {
+			result.Mode = true
+		}
+	}
+
+	// 属主需要权限，非特权用户修改失败时仅记录
+	if config.PreserveOwner {
+		if uid, gid, ok := fileOwner(m.info); !ok {
+			fail("owner", errUnsupported)
+		} else if err := os.Lchown(path, uid, gid); err != nil {
+			fail("owner", err)
+		} else {
+			result.Owner = true
+		}
+	}
+
+	if config.PreserveXattrs {
+		err := m.xattrsErr
+		if err == nil {
+			err = writeXattrs(path, m.xattrs)
+		}
+		if err != nil {
+			fail("xattrs", err)
+		} else {
+			result.Xattrs = true
+		}
+	}
+
+	// 时间戳最后设置，避免被其他元数据操作改动
+	if config.PreserveTimes {
+		if err := os.Chtimes(path, fileAtime(m.info), m.info.ModTime()); err != nil {
+			fail("times", err)
+		} else {
+			result.Times = true
+		}
+	}
+
+	return result
+}
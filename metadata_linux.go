@@ -0,0 +1,67 @@
+//go:build linux
+
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileAtime 返回文件的访问时间
+func fileAtime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Atim.Sec, st.Atim.Nsec)
+	}
+	return info.ModTime()
+}
+
+// readXattrs 读取文件的全部扩展属性
+func readXattrs(path string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+
+		valueSize, err := syscall.Getxattr(path, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, valueSize)
+		if valueSize > 0 {
+			valueSize, err = syscall.Getxattr(path, string(name), value)
+			if err != nil {
+				return nil, err
+			}
+		}
+		attrs[string(name)] = value[:valueSize]
+	}
+
+	return attrs, nil
+}
+
+// writeXattrs 将扩展属性写入文件
+func writeXattrs(path string, attrs map[string][]byte) error {
+	for name, value := range attrs {
+		if err := syscall.Setxattr(path, name, value, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package convertcontent2utf8
+
+import (
+	"os"
+	"time"
+)
+
+// fileAtime 非Linux平台无法统一获取访问时间，使用修改时间代替
+func fileAtime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// readXattrs 非Linux平台暂不支持扩展属性
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, errUnsupported
+}
+
+// writeXattrs 非Linux平台暂不支持扩展属性
+func writeXattrs(path string, attrs map[string][]byte) error {
+	return errUnsupported
+}
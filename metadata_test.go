@@ -0,0 +1,120 @@
+package convertcontent2utf8
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestPreserveMetadata(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not fully supported on Windows")
+	}
+
+	newScript := func(t *testing.T) string {
+		file := filepath.Join(t.TempDir(), "script.txt")
+		if err := os.WriteFile(file, []byte(gbkSample), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if err := os.Chmod(file, 0755); err != nil {
+			t.Fatalf("Failed to chmod test file: %v", err)
+		}
+		return file
+	}
+
+	t.Run("默认保留权限", func(t *testing.T) {
+		file := newScript(t)
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Failed to stat file: %v", err)
+		}
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("Expected mode 0755, got %v", info.Mode().Perm())
+		}
+		if result.Metadata == nil || !result.Metadata.Mode {
+			t.Errorf("Expected mode preservation to be recorded, got %+v", result.Metadata)
+		}
+	})
+
+	t.Run("关闭权限保留", func(t *testing.T) {
+		file := newScript(t)
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithPreserveMode(false))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Failed to stat file: %v", err)
+		}
+		if info.Mode().Perm() != defaultFileMode {
+			t.Errorf("Expected mode %v, got %v", defaultFileMode, info.Mode().Perm())
+		}
+		if result.Metadata != nil {
+			t.Errorf("Expected no metadata outcome, got %+v", result.Metadata)
+		}
+	})
+
+	t.Run("保留时间戳和属主", func(t *testing.T) {
+		file := newScript(t)
+		mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set file times: %v", err)
+		}
+
+		result, err := ConvertFile(file, file,
+			WithOverwrite(true),
+			WithBackup(false),
+			WithPreserveTimes(true),
+			WithPreserveOwner(true),
+		)
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Failed to stat file: %v", err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("Expected mtime %v, got %v", mtime, info.ModTime())
+		}
+		if !result.Metadata.Times {
+			t.Errorf("Expected times preservation to be recorded, got %+v", result.Metadata)
+		}
+		// 文件属于当前用户，修改为相同属主总是允许的
+		if !result.Metadata.Owner {
+			t.Errorf("Expected owner preservation to be recorded, got %+v", result.Metadata)
+		}
+	})
+
+	t.Run("保留扩展属性", func(t *testing.T) {
+		file := newScript(t)
+		if err := writeXattrs(file, map[string][]byte{"user.origin": []byte("legacy")}); err != nil {
+			t.Skipf("user xattrs are not supported here: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithPreserveXattrs(true))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if !result.Metadata.Xattrs {
+			t.Fatalf("Expected xattrs preservation to be recorded, got %+v", result.Metadata)
+		}
+
+		attrs, err := readXattrs(file)
+		if err != nil {
+			t.Fatalf("readXattrs failed: %v", err)
+		}
+		if string(attrs["user.origin"]) != "legacy" {
+			t.Errorf("Expected xattr user.origin=legacy, got %q", attrs["user.origin"])
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization 转码后对输出做的Unicode规范化，只支持UTF-8目标编码
+type Normalization string
+
+const (
+	NormalizeNone Normalization = "none" // 不规范化
+	NormalizeNFC  Normalization = "NFC"  // 标准等价合成，如"e"+U+0301合成为"é"
+	NormalizeNFD  Normalization = "NFD"  // 标准等价分解
+	NormalizeNFKC Normalization = "NFKC" // 兼容等价合成，如全角字母转为半角、"ﬁ"拆为"fi"
+)
+
+// normalizationForm 返回配置的规范化形式，不规范化时返回false
+func (c *Config) normalizationForm() (norm.Form, bool, error) {
+	var form norm.Form
+	switch c.Normalization {
+	case NormalizeNone, "":
+		return 0, false, nil
+	case NormalizeNFC:
+		form = norm.NFC
+	case NormalizeNFD:
+		form = norm.NFD
+	case NormalizeNFKC:
+		form = norm.NFKC
+	default:
+		return 0, false, fmt.Errorf("unknown normalization: %s", c.Normalization)
+	}
+	if !isUTF8Name(c.TargetEncoding) {
+		return 0, false, fmt.Errorf("%s normalization requires UTF-8 target encoding, got %s", c.Normalization, c.TargetEncoding)
+	}
+	return form, true, nil
+}
+
+// newTranscoder 按配置创建源编码到目标编码的转换器：需要时先改写file开头的字符集声明，逐字符转码，需要时接着做Unicode规范化
+func newTranscoder(config *Config, from, file string, log *replacementLog) (transform.Transformer, error) {
+	var chain []transform.Transformer
+	if rewriter := config.declarationRewriter(file, from, log); rewriter != nil {
+		chain = append(chain, rewriter)
+	}
+
+	t, err := newReplacingTranscoder(from, config.TargetEncoding, config.ReplacementPolicy, config.LineEnding, log)
+	if err != nil {
+		return nil, err
+	}
+	chain = append(chain, t)
+
+	form, ok, err := config.normalizationForm()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		chain = append(chain, &normalizer{form: form, log: log})
+	}
+
+	if len(chain) == 1 {
+		return t, nil
+	}
+	return transform.Chain(chain...), nil
+}
+
+// normalizer 按组合字符序列规范化UTF-8数据，统计发生变化的序列数量
+type normalizer struct {
+	form norm.Form
+	log  *replacementLog
+	buf  []byte
+}
+
+// Reset 实现transform.Transformer
+func (n *normalizer) Reset() {}
+
+// Transform 实现transform.Transformer，逐段规范化，各段之间互不影响
+func (n *normalizer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		size := n.form.NextBoundary(src[nSrc:], atEOF)
+		if size < 0 {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+
+		segment := src[nSrc : nSrc+size]
+		changed := false
+		if !n.form.IsNormal(segment) {
+			n.buf = n.form.Append(n.buf[:0], segment...)
+			changed = !bytes.Equal(n.buf, segment)
+			segment = n.buf
+		}
+		if len(segment) > len(dst)-nDst {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		if changed {
+			n.log.normalized++
+		}
+		nDst += copy(dst[nDst:], segment)
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
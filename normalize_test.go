@@ -0,0 +1,107 @@
+package convertcontent2utf8
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalization(t *testing.T) {
+	// "e"+U+0301和预组合的"é"
+	decomposed := "cafe\u0301"
+	composed := "caf\u00e9"
+
+	tests := []struct {
+		name     string
+		input    string
+		form     Normalization
+		expected string
+		count    int
+	}{
+		{"NFC合成", decomposed + " " + decomposed, NormalizeNFC, composed + " " + composed, 2},
+		{"NFD分解", composed, NormalizeNFD, decomposed, 1},
+		{"NFKC兼容合成", "\uff21\ufb01" + decomposed, NormalizeNFKC, "Afi" + composed, 3},
+		{"已是NFC", composed, NormalizeNFC, composed, 0},
+		{"不规范化", decomposed, NormalizeNone, decomposed, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converted, result, err := ConvertBytes([]byte(tt.input), WithNormalization(tt.form), WithMinConfidence(0))
+			if err != nil {
+				t.Fatalf("ConvertBytes failed: %v", err)
+			}
+			if string(converted) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(converted))
+			}
+			if result.NormalizedCount != tt.count {
+				t.Errorf("Expected NormalizedCount %d, got %d", tt.count, result.NormalizedCount)
+			}
+		})
+	}
+
+	t.Run("非UTF-8目标编码", func(t *testing.T) {
+		_, _, err := ConvertBytes([]byte(decomposed), WithNormalization(NormalizeNFC), WithTargetEncoding("GBK"))
+		if err == nil || !strings.Contains(err.Error(), "requires UTF-8") {
+			t.Errorf("Expected UTF-8 target error, got %v", err)
+		}
+	})
+
+	t.Run("未知形式", func(t *testing.T) {
+		if _, _, err := ConvertBytes([]byte("abc"), WithNormalization("NFX")); err == nil {
+			t.Error("Expected error for unknown normalization")
+		}
+	})
+
+	t.Run("原地转换已是UTF-8的文件", func(t *testing.T) {
+		tempDir := t.TempDir()
+		normal := filepath.Join(tempDir, "normal.txt")
+		denormal := filepath.Join(tempDir, "denormal.txt")
+		if err := os.WriteFile(normal, []byte(composed), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if err := os.WriteFile(denormal, []byte(strings.Repeat(decomposed+"\n", 3)), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(normal, normal, WithOverwrite(true), WithBackup(false), WithNormalization(NormalizeNFC))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputUnchanged {
+			t.Errorf("Expected normalized file to be unchanged, got %s", result.OutputAction)
+		}
+
+		result, err = ConvertFile(denormal, denormal, WithOverwrite(true), WithBackup(false), WithNormalization(NormalizeNFC), WithVerify(true))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.NormalizedCount != 3 || result.Verification != VerifyPassed {
+			t.Errorf("Expected 3 normalized characters and passed verification, got %d, %s", result.NormalizedCount, result.Verification)
+		}
+		content, _ := os.ReadFile(denormal)
+		if string(content) != strings.Repeat(composed+"\n", 3) {
+			t.Errorf("Expected NFC content, got %q", string(content))
+		}
+	})
+
+	t.Run("流式转换", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "stream.txt")
+		if err := os.WriteFile(file, []byte(strings.Repeat(decomposed, 2000)), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithStreamThreshold(1), WithNormalization(NormalizeNFC), WithUnchangedCheck(CheckNone))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.NormalizedCount != 2000 || !result.Changed {
+			t.Errorf("Expected 2000 normalized characters and Changed, got %d, %v", result.NormalizedCount, result.Changed)
+		}
+		content, _ := os.ReadFile(file)
+		if string(content) != strings.Repeat(composed, 2000) {
+			t.Error("Expected NFC content after streamed conversion")
+		}
+	})
+}
@@ -3,6 +3,7 @@ package convertcontent2utf8
 import (
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // WithProgress 设置进度回调
@@ -12,6 +13,13 @@ func WithProgress(callback func(Progress)) Option {
 	}
 }
 
+// WithResultCallback 设置批量结果回调，结果不再累积在内存中
+func WithResultCallback(callback func(*ConvertResult)) Option {
+	return func(c *Config) {
+		c.ResultCallback = callback
+	}
+}
+
 // WithTargetEncoding 设置目标编码
 func WithTargetEncoding(encoding string) Option {
 	return func(c *Config) {
@@ -26,6 +34,120 @@ func WithConcurrency(limit int) Option {
 	}
 }
 
+// WithUnchangedCheck 设置原地转换时判断文件无需转换的方式
+func WithUnchangedCheck(check UnchangedCheck) Option {
+	return func(c *Config) {
+		c.UnchangedCheck = check
+	}
+}
+
+// WithManifest 启用增量模式，使用指定的清单文件记录和跳过已处理的文件
+func WithManifest(path string) Option {
+	return func(c *Config) {
+		c.ManifestPath = path
+	}
+}
+
+// WithSourceEncoding 强制指定源编码，跳过自动检测；带BOM的文件仍按BOM
+func WithSourceEncoding(encoding string) Option {
+	return func(c *Config) {
+		c.SourceEncoding = encoding
+	}
+}
+
+// WithEncodingHint 设置提示编码，作为检测的优先候选：数据能按提示编码无误解码时采用
+func WithEncodingHint(encoding string) Option {
+	return func(c *Config) {
+		c.EncodingHint = encoding
+	}
+}
+
+// WithEncodingRules 追加按路径指定源编码的规则，先于SourceEncoding和EncodingHint生效
+func WithEncodingRules(rules ...EncodingRule) Option {
+	return func(c *Config) {
+		c.EncodingRules = append(c.EncodingRules, rules...)
+	}
+}
+
+// WithIncludeBinary 设置是否强制处理内容像二进制的文件，默认按文件头、NUL字节和控制字符识别后跳过
+func WithIncludeBinary(include bool) Option {
+	return func(c *Config) {
+		c.IncludeBinary = include
+	}
+}
+
+// WithCharsetDeclarations 设置是否处理文件内的字符集声明：按扩展名识别HTML、XML、CSS和Python文件，
+// 声明的字符集作为检测的提示，转换后把声明改为目标编码
+func WithCharsetDeclarations(enabled bool) Option {
+	return func(c *Config) {
+		c.CharsetDeclarations = enabled
+	}
+}
+
+// WithJournal 启用撤销日志，记录每个被改写文件的原内容，可用Undo恢复
+func WithJournal(path string) Option {
+	return func(c *Config) {
+		c.JournalPath = path
+	}
+}
+
+// WithReplacementPolicy 设置非法字节序列和目标编码无法表示的字符的处理策略
+func WithReplacementPolicy(policy ReplacementPolicy) Option {
+	return func(c *Config) {
+		c.ReplacementPolicy = policy
+	}
+}
+
+// WithLineEnding 设置换行符处理方式，在转码的同一遍中统一换行符
+func WithLineEnding(ending LineEnding) Option {
+	return func(c *Config) {
+		c.LineEnding = ending
+	}
+}
+
+// WithNormalization 设置转码后的Unicode规范化形式，只支持UTF-8目标编码
+func WithNormalization(form Normalization) Option {
+	return func(c *Config) {
+		c.Normalization = form
+	}
+}
+
+// WithBOMPolicy 设置输出的BOM策略
+func WithBOMPolicy(policy BOMPolicy) Option {
+	return func(c *Config) {
+		c.BOMPolicy = policy
+	}
+}
+
+// WithBOMExtensions 设置按扩展名添加BOM，扩展名在列表中的文件带BOM，其他文件不带
+func WithBOMExtensions(extensions ...string) Option {
+	return func(c *Config) {
+		c.BOMPolicy = BOMAddByExtension
+		c.BOMExtensions = extensions
+	}
+}
+
+// WithVerify 启用往返校验：输出须为合法的目标编码，且转回源编码后与原文件一致
+func WithVerify(enabled bool) Option {
+	return func(c *Config) {
+		c.Verify = enabled
+	}
+}
+
+// WithTransaction 启用事务模式，批量中任一文件失败或低置信度时不改动任何文件
+func WithTransaction(enabled bool) Option {
+	return func(c *Config) {
+		c.Transactional = enabled
+	}
+}
+
+// WithFileTimeout 设置单个文件的处理超时
+func WithFileTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.FileTimeout = timeout
+	}
+}
+
 // WithFileFilter 设置文件过滤器
 func WithFileFilter(filter func(string) bool) Option {
 	return func(c *Config) {
@@ -40,10 +162,44 @@ func WithBackup(create bool) Option {
 	}
 }
 
+// WithBackupMode 设置备份位置模式
+func WithBackupMode(mode BackupMode) Option {
+	return func(c *Config) {
+		c.BackupMode = mode
+	}
+}
+
+// WithBackupDir 设置备份目录（镜像和归档模式使用）
+func WithBackupDir(dir string) Option {
+	return func(c *Config) {
+		c.BackupDir = dir
+	}
+}
+
+// WithBackupSuffix 设置备份文件后缀
+func WithBackupSuffix(suffix string) Option {
+	return func(c *Config) {
+		c.BackupSuffix = suffix
+	}
+}
+
 // WithOverwrite 设置是否覆盖已存在文件
 func WithOverwrite(overwrite bool) Option {
 	return func(c *Config) {
 		c.OverwriteExisting = overwrite
+		if overwrite {
+			c.ExistingPolicy = ExistingOverwrite
+		} else {
+			c.ExistingPolicy = ExistingFail
+		}
+	}
+}
+
+// WithExistingPolicy 设置输出文件已存在时的处理策略
+func WithExistingPolicy(policy ExistingPolicy) Option {
+	return func(c *Config) {
+		c.ExistingPolicy = policy
+		c.OverwriteExisting = policy == ExistingOverwrite
 	}
 }
 
@@ -61,6 +217,41 @@ func WithDryRun(dryRun bool) Option {
 	}
 }
 
+// WithAtomicWrite 设置是否原子写入输出文件
+func WithAtomicWrite(atomic bool) Option {
+	return func(c *Config) {
+		c.AtomicWrite = atomic
+	}
+}
+
+// WithPreserveMode 设置是否保留源文件权限
+func WithPreserveMode(preserve bool) Option {
+	return func(c *Config) {
+		c.PreserveMode = preserve
+	}
+}
+
+// WithPreserveTimes 设置是否保留源文件访问和修改时间
+func WithPreserveTimes(preserve bool) Option {
+	return func(c *Config) {
+		c.PreserveTimes = preserve
+	}
+}
+
+// WithPreserveOwner 设置是否保留属主和属组
+func WithPreserveOwner(preserve bool) Option {
+	return func(c *Config) {
+		c.PreserveOwner = preserve
+	}
+}
+
+// WithPreserveXattrs 设置是否保留扩展属性
+func WithPreserveXattrs(preserve bool) Option {
+	return func(c *Config) {
+		c.PreserveXattrs = preserve
+	}
+}
+
 // WithSkipHidden 设置是否跳过隐藏文件
 func WithSkipHidden(skip bool) Option {
 	return func(c *Config) {
@@ -82,18 +273,36 @@ func WithMaxFileSize(size int64) Option {
 	}
 }
 
+// WithStreamThreshold 设置流式转换的文件大小阈值，0表示总是整体读入内存
+func WithStreamThreshold(size int64) Option {
+	return func(c *Config) {
+		c.StreamThreshold = size
+	}
+}
+
 // getDefaultConfig 获取默认配置
 func getDefaultConfig() *Config {
 	return &Config{
-		TargetEncoding:    "UTF-8",
-		ConcurrencyLimit:  4,
-		CreateBackup:      true,
-		OverwriteExisting: false,
-		MinConfidence:     0.8,
-		DryRun:            false,
-		SkipHidden:        true,
-		Recursive:         false,
-		MaxFileSize:       100 * 1024 * 1024, // 100MB
+		TargetEncoding:      "UTF-8",
+		ConcurrencyLimit:    4,
+		CreateBackup:        true,
+		BackupMode:          BackupSibling,
+		BackupSuffix:        ".bak",
+		OverwriteExisting:   false,
+		MinConfidence:       0.8,
+		UnchangedCheck:      CheckValidUTF8,
+		ReplacementPolicy:   ReplaceFail,
+		LineEnding:          LineEndingKeep,
+		Normalization:       NormalizeNone,
+		BOMPolicy:           BOMKeep,
+		CharsetDeclarations: true,
+		DryRun:              false,
+		AtomicWrite:         true,
+		PreserveMode:        true,
+		SkipHidden:          true,
+		Recursive:           false,
+		StreamThreshold:     16 * 1024 * 1024, // 16MB
+		MaxFileSize:         0,
 		FileFilter: func(filename string) bool {
 			// 默认只处理.txt文件
 			return filepath.Ext(strings.ToLower(filename)) == ".txt"
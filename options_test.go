@@ -89,6 +89,30 @@ func TestWithBackup(t *testing.T) {
 	}
 }
 
+func TestWithBackupOptions(t *testing.T) {
+	config := getDefaultConfig()
+	if config.BackupMode != BackupSibling {
+		t.Errorf("Expected default BackupMode %s, got %s", BackupSibling, config.BackupMode)
+	}
+	if config.BackupSuffix != ".bak" {
+		t.Errorf("Expected default BackupSuffix .bak, got %s", config.BackupSuffix)
+	}
+
+	WithBackupMode(BackupArchive)(config)
+	WithBackupDir("/tmp/backup")(config)
+	WithBackupSuffix(".orig")(config)
+
+	if config.BackupMode != BackupArchive {
+		t.Errorf("Expected BackupMode %s, got %s", BackupArchive, config.BackupMode)
+	}
+	if config.BackupDir != "/tmp/backup" {
+		t.Errorf("Expected BackupDir /tmp/backup, got %s", config.BackupDir)
+	}
+	if config.BackupSuffix != ".orig" {
+		t.Errorf("Expected BackupSuffix .orig, got %s", config.BackupSuffix)
+	}
+}
+
 func TestWithOverwrite(t *testing.T) {
 	testCases := []bool{true, false}
 
@@ -103,6 +127,24 @@ func TestWithOverwrite(t *testing.T) {
 	}
 }
 
+func TestWithExistingPolicy(t *testing.T) {
+	config := getDefaultConfig()
+	if config.existingPolicy() != ExistingFail {
+		t.Errorf("Expected default policy %s, got %s", ExistingFail, config.existingPolicy())
+	}
+
+	WithExistingPolicy(ExistingRename)(config)
+	if config.existingPolicy() != ExistingRename {
+		t.Errorf("Expected policy %s, got %s", ExistingRename, config.existingPolicy())
+	}
+
+	// 后设置的WithOverwrite覆盖之前的策略
+	WithOverwrite(true)(config)
+	if config.existingPolicy() != ExistingOverwrite {
+		t.Errorf("Expected policy %s, got %s", ExistingOverwrite, config.existingPolicy())
+	}
+}
+
 func TestWithMinConfidence(t *testing.T) {
 	testCases := []float64{0.5, 0.7, 0.9, 1.0}
 
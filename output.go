@@ -0,0 +1,76 @@
+package convertcontent2utf8
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxUniqueAttempts 生成唯一输出文件名的最大尝试次数
+const maxUniqueAttempts = 10000
+
+// existingPolicy 返回生效的已存在输出文件策略，未显式设置时由OverwriteExisting决定
+func (c *Config) existingPolicy() ExistingPolicy {
+	if c.ExistingPolicy != "" {
+		return c.ExistingPolicy
+	}
+	if c.OverwriteExisting {
+		return ExistingOverwrite
+	}
+	return ExistingFail
+}
+
+// resolveOutput 根据策略决定如何处理输出文件
+func resolveOutput(config *Config, outputFile string) (OutputAction, error) {
+	_, err := os.Stat(outputFile)
+	if os.IsNotExist(err) {
+		return OutputCreated, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch policy := config.existingPolicy(); policy {
+	case ExistingOverwrite:
+		return OutputOverwritten, nil
+	case ExistingSkip:
+		return OutputSkipped, nil
+	case ExistingRename:
+		return OutputRenamed, nil
+	case ExistingFail:
+		return "", fmt.Errorf("%w: %s", ErrOutputExists, outputFile)
+	default:
+		return "", fmt.Errorf("unknown existing output policy: %s", policy)
+	}
+}
+
+// uniqueOutputPath 为输出文件生成带数字后缀的唯一路径
+// 非试运行时以独占方式创建空文件占位，避免并发任务选中同一路径
+func uniqueOutputPath(outputFile string, reserve bool) (string, error) {
+	ext := filepath.Ext(outputFile)
+	base := strings.TrimSuffix(outputFile, ext)
+
+	for i := 1; i <= maxUniqueAttempts; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+
+		if !reserve {
+			if _, err := os.Stat(candidate); os.IsNotExist(err) {
+				return candidate, nil
+			}
+			continue
+		}
+
+		f, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		f.Close()
+		return candidate, nil
+	}
+
+	return "", fmt.Errorf("failed to find a unique name for %s", outputFile)
+}
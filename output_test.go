@@ -0,0 +1,156 @@
+package convertcontent2utf8
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExistingPolicy(t *testing.T) {
+	testDir := t.TempDir()
+	input := filepath.Join(testDir, "input.txt")
+	if err := os.WriteFile(input, []byte(gbkSample), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	newOutput := func(t *testing.T, name string) string {
+		output := filepath.Join(testDir, name)
+		if err := os.WriteFile(output, []byte("existing"), 0644); err != nil {
+			t.Fatalf("Failed to create output file: %v", err)
+		}
+		return output
+	}
+
+	t.Run("输出不存在", func(t *testing.T) {
+		result, err := ConvertFile(input, filepath.Join(testDir, "created.txt"))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputCreated {
+			t.Errorf("Expected OutputAction %s, got %s", OutputCreated, result.OutputAction)
+		}
+	})
+
+	t.Run("默认报错", func(t *testing.T) {
+		output := newOutput(t, "fail.txt")
+		if _, err := ConvertFile(input, output); err == nil {
+			t.Error("Expected error when output exists")
+		}
+
+		data, _ := os.ReadFile(output)
+		if string(data) != "existing" {
+			t.Error("Existing output should not be modified")
+		}
+	})
+
+	t.Run("跳过", func(t *testing.T) {
+		output := newOutput(t, "skip.txt")
+		result, err := ConvertFile(input, output, WithExistingPolicy(ExistingSkip))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputSkipped {
+			t.Errorf("Expected OutputAction %s, got %s", OutputSkipped, result.OutputAction)
+		}
+
+		data, _ := os.ReadFile(output)
+		if string(data) != "existing" {
+			t.Error("Skipped output should not be modified")
+		}
+	})
+
+	t.Run("覆盖", func(t *testing.T) {
+		output := newOutput(t, "overwrite.txt")
+		result, err := ConvertFile(input, output, WithExistingPolicy(ExistingOverwrite), WithBackup(false))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputOverwritten {
+			t.Errorf("Expected OutputAction %s, got %s", OutputOverwritten, result.OutputAction)
+		}
+	})
+
+	t.Run("唯一后缀", func(t *testing.T) {
+		output := newOutput(t, "rename.txt")
+		result, err := ConvertFile(input, output, WithExistingPolicy(ExistingRename))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputRenamed {
+			t.Errorf("Expected OutputAction %s, got %s", OutputRenamed, result.OutputAction)
+		}
+
+		expected := filepath.Join(testDir, "rename_1.txt")
+		if result.OutputFile != expected {
+			t.Errorf("Expected OutputFile %s, got %s", expected, result.OutputFile)
+		}
+		if result.BackupFile != "" {
+			t.Errorf("Expected no backup for renamed output, got %s", result.BackupFile)
+		}
+
+		data, _ := os.ReadFile(output)
+		if string(data) != "existing" {
+			t.Error("Original output should not be modified")
+		}
+	})
+
+	t.Run("批量应用策略", func(t *testing.T) {
+		files := []string{
+			newOutput(t, "batch1.txt"),
+			newOutput(t, "batch2.txt"),
+		}
+		// 非UTF-8内容，避免被预检判为无需转换
+		for _, file := range files {
+			if err := os.WriteFile(file, []byte(gbkSample), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+
+		result, err := ConvertFiles(files, WithExistingPolicy(ExistingSkip))
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if result.SkippedFiles != 2 {
+			t.Errorf("Expected SkippedFiles 2, got %d", result.SkippedFiles)
+		}
+		for _, r := range result.Results {
+			if r.OutputAction != OutputSkipped {
+				t.Errorf("Expected OutputAction %s for %s, got %s", OutputSkipped, r.InputFile, r.OutputAction)
+			}
+		}
+
+		result, err = ConvertFiles(files)
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if result.FailedFiles != 2 {
+			t.Errorf("Expected FailedFiles 2, got %d", result.FailedFiles)
+		}
+		for _, e := range result.Errors {
+			if e.Operation != "output_exists" {
+				t.Errorf("Expected operation output_exists, got %s", e.Operation)
+			}
+		}
+	})
+}
+
+func TestUniqueOutputPath(t *testing.T) {
+	testDir := t.TempDir()
+	output := filepath.Join(testDir, "file.txt")
+
+	first, err := uniqueOutputPath(output, true)
+	if err != nil {
+		t.Fatalf("uniqueOutputPath failed: %v", err)
+	}
+	second, err := uniqueOutputPath(output, true)
+	if err != nil {
+		t.Fatalf("uniqueOutputPath failed: %v", err)
+	}
+
+	if first == second {
+		t.Errorf("Expected distinct paths, got %s twice", first)
+	}
+	if _, err := os.Stat(first); err != nil {
+		t.Errorf("Expected reserved placeholder at %s", first)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package convertcontent2utf8
+
+import "os"
+
+// fileOwner 非Unix平台没有属主概念
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
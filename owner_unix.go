@@ -0,0 +1,17 @@
+//go:build unix
+
+package convertcontent2utf8
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner 返回文件的属主和属组
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
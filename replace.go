@@ -0,0 +1,464 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+// ReplacementPolicy 源数据中的非法字节序列和目标编码无法表示的字符的处理策略
+type ReplacementPolicy string
+
+const (
+	ReplaceFail       ReplacementPolicy = "fail"       // 报错，不写入输出
+	ReplaceSubstitute ReplacementPolicy = "substitute" // 替换为U+FFFD，目标编码无法表示时替换为'?'
+	ReplaceEntity     ReplacementPolicy = "entity"     // 目标编码无法表示的字符写为HTML/XML数字实体，如"&#8364;"
+)
+
+// ReplacementKind 被替换内容的类型
+type ReplacementKind string
+
+const (
+	ReplacedInvalid    ReplacementKind = "invalid"    // 源数据中的非法字节序列
+	ReplacedUnmappable ReplacementKind = "unmappable" // 目标编码无法表示的字符
+)
+
+// maxReportedReplacements 每个结果最多列出的替换位置，ReplacementCount不受此限制
+const maxReportedReplacements = 1000
+
+// maxSequenceLen 解码单个字符时最多向前查看的字节数
+const maxSequenceLen = 16
+
+// decodeRunSize 整块解码时每次最多解码的输入字节数
+const decodeRunSize = 1024
+
+// runeErrorBytes U+FFFD的UTF-8编码，整块解码的输出中出现时说明有非法序列
+var runeErrorBytes = []byte(string(utf8.RuneError))
+
+// Replacement 一处被替换的内容
+type Replacement struct {
+	Kind   ReplacementKind `json:"kind"`
+	Offset int64           `json:"offset"`         // 在输入中的字节偏移
+	Line   int             `json:"line"`           // 从1开始的行号
+	Column int             `json:"column"`         // 从1开始的列号，按字符计
+	Rune   rune            `json:"rune,omitempty"` // 无法表示的字符，非法序列时为空
+}
+
+// replacementLog 记录转换中的替换（最多保留maxReportedReplacements条位置）、输入中的换行符和规范化的字符数
+type replacementLog struct {
+	count      int
+	items      []Replacement
+	endings    LineEndingCounts
+	normalized int
+
+	declared     string
+	declarations int
+	edits        []declarationEdit // 转码前对字符集声明的改写，用于把位置换算回输入
+}
+
+// add 记录一处替换
+func (l *replacementLog) add(r Replacement) {
+	l.count++
+	if len(l.items) < maxReportedReplacements {
+		l.items = append(l.items, r)
+	}
+}
+
+// apply 把替换、换行符、规范化和字符集声明的统计写入结果
+func (l *replacementLog) apply(result *ConvertResult) {
+	result.ReplacementCount = l.count
+	result.Replacements = l.items
+	result.LineEndings = l.endings
+	result.NormalizedCount = l.normalized
+	result.DeclaredEncoding = l.declared
+	result.DeclarationCount = l.declarations
+}
+
+// replacingTranscoder 逐字符转码并按策略处理非法序列和无法表示的字符，记录每处替换的位置
+// 同时统计换行符，需要时统一为目标换行符
+type replacingTranscoder struct {
+	decoder  transform.Transformer // 源编码解码器，源为UTF-8时为nil
+	encoder  transform.Transformer // 目标编码编码器，目标为UTF-8时为nil
+	unicode  bool                  // 源为UTF-16/32，解码出的U+FFFD视为正文
+	stateful bool                  // 解码器有状态（HZ），不能整块试解码后再逐字符重来
+	from, to string
+	policy   ReplacementPolicy
+	log      *replacementLog
+	fallback []byte // 目标编码中的替换字符
+	newline  []byte // 目标编码中的目标换行符，保持原样时为nil
+
+	offset  int64
+	line    int
+	column  int
+	afterCR bool   // 上一个字符是CR，据下一个字符区分CRLF和单独的CR
+	pending []byte // 上次未能写入dst的输出
+	flushed bool
+
+	// 整块解码发现非法序列后，在此偏移之前逐字符解码
+	slowUntil int64
+
+	decoded [64]byte
+	encoded [64]byte
+	run     [4 * decodeRunSize]byte
+	runes   []decodedRune
+	out     []byte
+}
+
+// newReplacingTranscoder 创建源编码到目标编码的转码器，替换记录和换行符统计写入log
+func newReplacingTranscoder(from, to string, policy ReplacementPolicy, ending LineEnding, log *replacementLog) (*replacingTranscoder, error) {
+	switch policy {
+	case "":
+		policy = ReplaceFail
+	case ReplaceFail, ReplaceSubstitute, ReplaceEntity:
+	default:
+		return nil, fmt.Errorf("unknown replacement policy: %s", policy)
+	}
+	newline, err := newlineFor(ending)
+	if err != nil {
+		return nil, err
+	}
+	t := &replacingTranscoder{from: from, to: to, policy: policy, log: log}
+	if newline != "" {
+		t.newline = []byte(newline)
+	}
+
+	if !isUTF8Name(from) {
+		src, err := lookupEncoding(from)
+		if err != nil {
+			return nil, err
+		}
+		t.decoder = src.NewDecoder()
+		t.unicode = strings.HasPrefix(strings.ToUpper(from), "UTF-")
+		t.stateful = strings.EqualFold(from, "HZ")
+	}
+
+	t.fallback = []byte(string(utf8.RuneError))
+	if !isUTF8Name(to) {
+		dst, err := lookupEncoding(to)
+		if err != nil {
+			return nil, err
+		}
+		t.encoder = dst.NewEncoder()
+
+		// 目标编码能表示U+FFFD时用它替换，否则用'?'
+		t.fallback, _, err = transform.Bytes(dst.NewEncoder(), t.fallback)
+		if err != nil {
+			t.fallback = []byte("?")
+		}
+		if t.newline != nil {
+			if t.newline, _, err = transform.Bytes(dst.NewEncoder(), t.newline); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	t.Reset()
+	return t, nil
+}
+
+// checkReplacing 检查两个编码都能由replacingTranscoder处理
+func checkReplacing(from, to string) error {
+	if _, err := lookupEncoding(from); err != nil {
+		return err
+	}
+	_, err := lookupEncoding(to)
+	return err
+}
+
+// Reset 重置位置和编解码器状态
+func (t *replacingTranscoder) Reset() {
+	t.offset, t.line, t.column = 0, 1, 1
+	t.afterCR = false
+	t.pending = nil
+	t.flushed = false
+	t.slowUntil = 0
+	if t.decoder != nil {
+		t.decoder.Reset()
+	}
+	if t.encoder != nil {
+		t.encoder.Reset()
+	}
+}
+
+// Transform 实现transform.Transformer
+func (t *replacingTranscoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	if len(t.pending) > 0 {
+		n := copy(dst, t.pending)
+		nDst = n
+		t.pending = t.pending[n:]
+		if len(t.pending) > 0 {
+			return nDst, 0, transform.ErrShortDst
+		}
+	}
+
+	for nSrc < len(src) {
+		t.out = t.out[:0]
+		run, size := t.decodeRun(src[nSrc:], atEOF)
+		if size > 0 {
+			t.emitRun(run)
+		} else {
+			var runes []decodedRune
+			runes, size, err = t.decode(src[nSrc:], atEOF)
+			if err != nil {
+				return nDst, nSrc, err
+			}
+			for _, r := range runes {
+				if err := t.emit(r); err != nil {
+					return nDst, nSrc, err
+				}
+			}
+		}
+		t.offset += int64(size)
+		nSrc += size
+
+		n := copy(dst[nDst:], t.out)
+		nDst += n
+		if n < len(t.out) {
+			t.pending = append(t.pending[:0], t.out[n:]...)
+			return nDst, nSrc, transform.ErrShortDst
+		}
+	}
+
+	// 输入以CR结尾
+	if atEOF && t.afterCR {
+		t.afterCR = false
+		t.log.endings.CR++
+	}
+
+	// 输入结束时让有状态的编码器输出收尾序列
+	if atEOF && !t.flushed && t.encoder != nil {
+		t.flushed = true
+		n, _, err := t.encoder.Transform(t.encoded[:], nil, true)
+		if err != nil {
+			return nDst, nSrc, err
+		}
+		copied := copy(dst[nDst:], t.encoded[:n])
+		nDst += copied
+		if copied < n {
+			t.pending = append(t.pending[:0], t.encoded[copied:n]...)
+			return nDst, nSrc, transform.ErrShortDst
+		}
+	}
+	return nDst, nSrc, nil
+}
+
+// decodedRune 解码出的字符，invalid表示由非法序列替换而来
+type decodedRune struct {
+	r       rune
+	invalid bool
+}
+
+// decodeRun 目标为UTF-8时整块解码src开头的一段，返回解码出的UTF-8数据和消耗的字节数，返回0表示需要逐字符解码
+// 段中有非法序列时不产生输出，这一段改为逐字符解码，以便记录每处替换的位置
+func (t *replacingTranscoder) decodeRun(src []byte, atEOF bool) ([]byte, int) {
+	if t.encoder != nil || t.stateful || t.offset < t.slowUntil {
+		return nil, 0
+	}
+
+	chunk := src[:min(len(src), decodeRunSize)]
+	last := atEOF && len(chunk) == len(src)
+	var decoded []byte
+	n := 0
+	if t.decoder == nil {
+		if !last {
+			chunk = trimIncompleteUTF8(chunk)
+		}
+		decoded, n = chunk, len(chunk)
+		if !utf8.Valid(decoded) {
+			t.slowUntil = t.offset + int64(n)
+			return nil, 0
+		}
+	} else {
+		nDst, nSrc, err := t.decoder.Transform(t.run[:], chunk, last)
+		if err != nil && err != transform.ErrShortSrc && err != transform.ErrShortDst {
+			t.decoder.Reset()
+			t.slowUntil = t.offset + int64(len(chunk))
+			return nil, 0
+		}
+		decoded, n = t.run[:nDst], nSrc
+		if !t.unicode && bytes.Contains(decoded, runeErrorBytes) {
+			t.slowUntil = t.offset + int64(n)
+			return nil, 0
+		}
+	}
+	return decoded, n
+}
+
+// emitRun 把整块解码出的合法UTF-8数据写入t.out，换行符交给emit处理，其余字符只推进列号
+func (t *replacingTranscoder) emitRun(decoded []byte) {
+	start := 0
+	for i, b := range decoded {
+		switch {
+		case b == '\n' || b == '\r':
+			t.out = append(t.out, decoded[start:i]...)
+			start = i + 1
+			// 目标为UTF-8且字符合法，emit不会出错
+			t.emit(decodedRune{r: rune(b)})
+		case utf8.RuneStart(b):
+			if t.afterCR {
+				t.afterCR = false
+				t.log.endings.CR++
+			}
+			t.column++
+		}
+	}
+	t.out = append(t.out, decoded[start:]...)
+}
+
+// decode 从src开头解码一个字符，返回解码结果和消耗的字节数
+// 有状态的解码器可能只消耗字节而不产生字符（如BOM和换码序列）
+func (t *replacingTranscoder) decode(src []byte, atEOF bool) ([]decodedRune, int, error) {
+	if t.decoder == nil {
+		if !atEOF && !utf8.FullRune(src) {
+			return nil, 0, transform.ErrShortSrc
+		}
+		r, size := utf8.DecodeRune(src)
+		t.runes = append(t.runes[:0], decodedRune{r: r, invalid: r == utf8.RuneError && size <= 1})
+		return t.runes, size, nil
+	}
+
+	// 逐步扩大输入窗口，直到解码器能产生完整的字符
+	limit := len(src)
+	if limit > maxSequenceLen {
+		limit = maxSequenceLen
+	}
+	for k := 1; k <= limit; k++ {
+		last := atEOF && k == len(src)
+		nDst, n, err := t.decoder.Transform(t.decoded[:], src[:k], last)
+		if n == 0 && (err == nil || err == transform.ErrShortSrc) {
+			continue
+		}
+		if err != nil && err != transform.ErrShortSrc {
+			return nil, 0, err
+		}
+
+		t.runes = t.runes[:0]
+		for data := t.decoded[:nDst]; len(data) > 0; {
+			r, size := utf8.DecodeRune(data)
+			t.runes = append(t.runes, decodedRune{r: r, invalid: r == utf8.RuneError && !t.unicode})
+			data = data[size:]
+		}
+		return t.runes, n, nil
+	}
+
+	if !atEOF && len(src) < maxSequenceLen {
+		return nil, 0, transform.ErrShortSrc
+	}
+	return nil, 0, fmt.Errorf("undecodable %s sequence at offset %d", t.from, t.offset)
+}
+
+// locate 把at的偏移和列号从转码器看到的数据换算回输入，扣除改写字符集声明带来的长度变化
+func (t *replacingTranscoder) locate(at *Replacement) {
+	offset := at.Offset
+	for _, e := range t.log.edits {
+		if e.end <= offset {
+			at.Offset -= e.delta
+			if e.line == at.Line {
+				at.Column -= int(e.delta)
+			}
+		}
+	}
+}
+
+// emit 把一个字符按目标编码写入t.out，按策略处理非法序列和无法表示的字符，并推进行列位置
+// LF、CRLF和单独的CR都算作换行，需要时写为目标换行符
+func (t *replacingTranscoder) emit(d decodedRune) error {
+	at := Replacement{Offset: t.offset, Line: t.line, Column: t.column}
+	afterCR := t.afterCR
+	t.afterCR = d.r == '\r'
+
+	switch {
+	case d.r == '\n' && afterCR:
+		// CRLF的换行已在CR处计入并写出
+		t.log.endings.CRLF++
+		if t.newline != nil {
+			return nil
+		}
+	case d.r == '\n' || d.r == '\r':
+		if d.r == '\n' {
+			t.log.endings.LF++
+		} else if afterCR {
+			t.log.endings.CR++
+		}
+		t.line++
+		t.column = 1
+		if t.newline != nil {
+			t.out = append(t.out, t.newline...)
+			return nil
+		}
+	default:
+		if afterCR {
+			t.log.endings.CR++
+		}
+		t.column++
+	}
+
+	if d.invalid {
+		t.locate(&at)
+		if t.policy == ReplaceFail {
+			return fmt.Errorf("%w in %s at line %d, column %d (offset %d)", ErrInvalidSequence, t.from, at.Line, at.Column, at.Offset)
+		}
+		at.Kind = ReplacedInvalid
+		t.log.add(at)
+	}
+
+	if t.encoder == nil {
+		t.out = utf8.AppendRune(t.out, d.r)
+		return nil
+	}
+	if encoded, ok := t.encodeRune(d.r); ok {
+		t.out = append(t.out, encoded...)
+		return nil
+	}
+
+	if !d.invalid {
+		t.locate(&at)
+		if t.policy == ReplaceFail {
+			return fmt.Errorf("%w %s: %U at line %d, column %d (offset %d)", ErrUnmappable, t.to, d.r, at.Line, at.Column, at.Offset)
+		}
+		at.Kind = ReplacedUnmappable
+		at.Rune = d.r
+		t.log.add(at)
+	}
+
+	if t.policy == ReplaceEntity {
+		t.out = append(t.out, "&#"+strconv.Itoa(int(d.r))+";"...)
+		return nil
+	}
+	t.out = append(t.out, t.fallback...)
+	return nil
+}
+
+// encodeRune 按目标编码编码一个字符，目标编码无法表示时返回false
+func (t *replacingTranscoder) encodeRune(r rune) ([]byte, bool) {
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], r)
+	nDst, _, err := t.encoder.Transform(t.encoded[:], buf[:n], false)
+	if err != nil {
+		return nil, false
+	}
+	return t.encoded[:nDst], true
+}
+
+// transcodeData 整体转换内存中的数据，逐字符转码并记录替换、换行符和规范化；编码不受支持时返回ErrUnsupportedEncoding，与流式转换一致
+// file用于按扩展名改写字符集声明，内存转换时为空
+func transcodeData(config *Config, data []byte, from, file string) ([]byte, *replacementLog, error) {
+	log := &replacementLog{}
+	if err := checkReplacing(from, config.TargetEncoding); err != nil {
+		return nil, nil, err
+	}
+
+	t, err := newTranscoder(config, from, file, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	converted, _, err := transform.Bytes(t, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return converted, log, nil
+}
@@ -0,0 +1,172 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReplacementPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		from, to string
+		policy   ReplacementPolicy
+		expected string
+		kind     ReplacementKind
+		line     int
+		column   int
+		offset   int64
+	}{
+		{"无法表示的字符替换为问号", "ab\n中😀c", "UTF-8", "GBK", ReplaceSubstitute, "ab\n\xd6\xd0?c", ReplacedUnmappable, 2, 2, 6},
+		{"无法表示的字符写为数字实体", "ab\n中😀c", "UTF-8", "GBK", ReplaceEntity, "ab\n\xd6\xd0&#128512;c", ReplacedUnmappable, 2, 2, 6},
+		{"非法UTF-8替换为U+FFFD", "ab\xffc", "UTF-8", "UTF-8", ReplaceSubstitute, "ab�c", ReplacedInvalid, 1, 3, 2},
+		{"非法GBK序列", "\xd6\xd0\n\x81\x20x", "GBK", "UTF-8", ReplaceSubstitute, "中\n� x", ReplacedInvalid, 2, 1, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := getDefaultConfig()
+			config.TargetEncoding = tt.to
+			config.ReplacementPolicy = tt.policy
+
+			converted, log, err := transcodeData(config, []byte(tt.input), tt.from, "")
+			if err != nil {
+				t.Fatalf("transcodeData failed: %v", err)
+			}
+			if string(converted) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(converted))
+			}
+			if log.count != 1 || len(log.items) != 1 {
+				t.Fatalf("Expected 1 replacement, got %d", log.count)
+			}
+
+			r := log.items[0]
+			if r.Kind != tt.kind {
+				t.Errorf("Expected kind %s, got %s", tt.kind, r.Kind)
+			}
+			if r.Line != tt.line || r.Column != tt.column {
+				t.Errorf("Expected position %d:%d, got %d:%d", tt.line, tt.column, r.Line, r.Column)
+			}
+			if r.Offset != tt.offset {
+				t.Errorf("Expected offset %d, got %d", tt.offset, r.Offset)
+			}
+		})
+	}
+
+	t.Run("失败策略", func(t *testing.T) {
+		config := getDefaultConfig()
+		config.TargetEncoding = "GBK"
+		config.ReplacementPolicy = ReplaceFail
+
+		_, _, err := transcodeData(config, []byte("ab😀"), "UTF-8", "")
+		if err == nil {
+			t.Fatal("Expected error for unmappable character")
+		}
+		if !strings.Contains(err.Error(), "line 1, column 3") {
+			t.Errorf("Expected error to contain the position, got %v", err)
+		}
+	})
+
+	t.Run("不支持的编码", func(t *testing.T) {
+		_, _, err := transcodeData(getDefaultConfig(), []byte("abc"), "EBCDIC", "")
+		if !errors.Is(err, ErrUnsupportedEncoding) {
+			t.Errorf("Expected ErrUnsupportedEncoding, got %v", err)
+		}
+	})
+
+	t.Run("流式转换逐字节读取", func(t *testing.T) {
+		input := strings.Repeat(gbkSample, 10) + "\x81\x20"
+		log := &replacementLog{}
+		config := getDefaultConfig()
+		config.ReplacementPolicy = ReplaceSubstitute
+
+		var out bytes.Buffer
+		_, _, err := transcodeStream(context.Background(), config, iotest.OneByteReader(strings.NewReader(input)), &out, "GBK", "", log)
+		if err != nil {
+			t.Fatalf("transcodeStream failed: %v", err)
+		}
+		expected := strings.Repeat(gbkSampleText, 10) + "� "
+		if out.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, out.String())
+		}
+		if log.count != 1 || log.items[0].Offset != int64(len(gbkSample)*10) {
+			t.Errorf("Expected 1 replacement at offset %d, got %+v", len(gbkSample)*10, log.items)
+		}
+	})
+
+	t.Run("整块解码中的非法序列", func(t *testing.T) {
+		// 非法字节前后都超过一个整块，位置仍按逐字符计算
+		line := gbkSample + "\r\n"
+		input := strings.Repeat(line, 100) + gbkSample[:4] + "\x81\x20" + strings.Repeat(line, 100)
+		expected := strings.Repeat(gbkSampleText+"\r\n", 100) + "这是� " + strings.Repeat(gbkSampleText+"\r\n", 100)
+		offset := int64(len(line)*100 + 4)
+		config := getDefaultConfig()
+		config.ReplacementPolicy = ReplaceSubstitute
+
+		converted, log, err := transcodeData(config, []byte(input), "GBK", "")
+		if err != nil {
+			t.Fatalf("transcodeData failed: %v", err)
+		}
+		if string(converted) != expected {
+			t.Error("Unexpected output from transcodeData")
+		}
+		if log.count != 1 || log.items[0].Offset != offset || log.items[0].Line != 101 || log.items[0].Column != 3 {
+			t.Errorf("Expected 1 replacement at offset %d, 101:3, got %+v", offset, log.items)
+		}
+		if log.endings.CRLF != 200 {
+			t.Errorf("Expected 200 CRLF, got %+v", log.endings)
+		}
+
+		log = &replacementLog{}
+		var out bytes.Buffer
+		_, _, err = transcodeStream(context.Background(), config, iotest.OneByteReader(strings.NewReader(input)), &out, "GBK", "", log)
+		if err != nil {
+			t.Fatalf("transcodeStream failed: %v", err)
+		}
+		if out.String() != expected {
+			t.Error("Unexpected output from transcodeStream")
+		}
+		if log.count != 1 || log.items[0].Offset != offset {
+			t.Errorf("Expected 1 replacement at offset %d, got %+v", offset, log.items)
+		}
+	})
+
+	t.Run("文件结果记录替换", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "invalid.txt")
+		input := strings.Repeat(gbkSample, 20) + "\n\x81\x20"
+		if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithMinConfidence(0), WithReplacementPolicy(ReplaceSubstitute))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.ReplacementCount != 1 {
+			t.Fatalf("Expected ReplacementCount 1, got %d", result.ReplacementCount)
+		}
+		if r := result.Replacements[0]; r.Line != 2 || r.Column != 1 {
+			t.Errorf("Expected position 2:1, got %d:%d", r.Line, r.Column)
+		}
+	})
+}
+
+// 性能测试：整块转码约8MB的GBK数据
+func BenchmarkTranscodeData(b *testing.B) {
+	data := []byte(strings.Repeat(gbkSample+"\n", 8*1024*1024/(len(gbkSample)+1)))
+	config := getDefaultConfig()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := transcodeData(config, data, "GBK", ""); err != nil {
+			b.Fatalf("transcodeData failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package convertcontent2utf8
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	encoding "github.com/mirbf/encoding-processor"
+	"golang.org/x/text/transform"
+)
+
+// detectionSampleSize 流式转换检测编码时读取的前缀大小
+const detectionSampleSize = encoding.DefaultSampleSize
+
+// ConvertReader 流式转换：从有界前缀检测源编码，再分块转码写入w
+// 内存占用与输入大小无关；转码器会在块边界处保留不完整的多字节序列
+func ConvertReader(ctx context.Context, r io.Reader, w io.Writer, options ...Option) (*ConvertResult, error) {
+	return NewConverter(options...).ConvertReader(ctx, r, w)
+}
+
+// ConvertReader 流式转换r中的数据写入w
+func (c *Converter) ConvertReader(ctx context.Context, r io.Reader, w io.Writer) (*ConvertResult, error) {
+	config := c.config
+	start := time.Now()
+
+	// 预读前缀判断是否为二进制，预读的数据仍留在缓冲读取器中
+	buffered := bufio.NewReaderSize(r, binarySniffSize)
+	sample, err := buffered.Peek(binarySniffSize)
+	if err != nil && err != io.EOF {
+		return nil, newConvertError("", OpRead, err)
+	}
+	if err := checkBinary(config, sample); err != nil {
+		return nil, newConvertError("", OpBinary, err)
+	}
+
+	source, detection, inputBOM, err := detectStream(config, c.processor, buffered, "")
+	if err != nil {
+		return nil, newConvertError("", OpDetect, err)
+	}
+
+	if err := checkConfidence(config, detection); err != nil {
+		return nil, newConvertError("", OpLowConfidence, withEncoding(err, detection.Encoding))
+	}
+
+	outputBOM, err := config.outputBOM("", inputBOM)
+	if err != nil {
+		return nil, newConvertError("", OpConvert, withEncoding(err, detection.Encoding))
+	}
+	if _, err := w.Write(outputBOM.Bytes()); err != nil {
+		return nil, newConvertError("", OpWrite, withEncoding(err, detection.Encoding))
+	}
+
+	newline, err := newlineFor(config.LineEnding)
+	if err != nil {
+		return nil, newConvertError("", OpConvert, withEncoding(err, detection.Encoding))
+	}
+
+	log := &replacementLog{}
+	read, written, err := transcodeStream(ctx, config, source, w, detection.Encoding, "", log)
+	if err != nil {
+		return nil, newConvertError("", OpConvert, withEncoding(err, detection.Encoding))
+	}
+
+	result := &ConvertResult{
+		SourceEncoding:      detection.Encoding,
+		TargetEncoding:      config.TargetEncoding,
+		BytesProcessed:      read + int64(len(inputBOM.Bytes())),
+		OutputBytes:         written + int64(len(outputBOM.Bytes())),
+		Changed:             !sameEncoding(detection.Encoding, config.TargetEncoding) || inputBOM != outputBOM || !log.endings.conforms(newline) || log.normalized > 0,
+		ProcessingTime:      time.Since(start),
+		DetectionConfidence: detection.Confidence,
+		InputBOM:            inputBOM,
+		OutputBOM:           outputBOM,
+	}
+	log.apply(result)
+	return result, nil
+}
+
+// detectStream 读取有界前缀确定源编码，返回包含前缀、去掉开头BOM的完整读取器和识别到的BOM
+// 带BOM或指定了编码时按detectSource处理；否则仅凭前缀判断：前缀为纯ASCII时只能猜测为UTF-8，
+// 之后遇到非法UTF-8即报错（ErrInvalidSequence），不按替换策略处理，以免把其他编码的内容整段替换掉
+// file用于匹配编码规则，流式转换时为空
+func detectStream(config *Config, processor encoding.Processor, r io.Reader, file string) (io.Reader, *encoding.DetectionResult, BOM, error) {
+	prefix := make([]byte, detectionSampleSize)
+	n, err := io.ReadFull(r, prefix)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, BOMNone, err
+	}
+	prefix = prefix[:n]
+
+	detection, bom, err := detectSource(config, processor, prefix, file, n == len(prefix) && n == detectionSampleSize)
+	if err != nil {
+		return nil, nil, BOMNone, err
+	}
+
+	if hint, _ := config.sourceHint(file); bom == BOMNone && hint == "" && n == detectionSampleSize &&
+		isUTF8Name(detection.Encoding) && validText(prefix, true) {
+		r = &utf8Guard{reader: r, offset: int64(n)}
+	}
+	return io.MultiReader(bytes.NewReader(prefix[len(bom.Bytes()):]), r), detection, bom, nil
+}
+
+// utf8Guard 检查源编码只凭ASCII前缀猜测为UTF-8的流，遇到非法UTF-8时报错
+type utf8Guard struct {
+	reader io.Reader
+	offset int64  // 已检查数据的终点在流中的偏移
+	tail   []byte // 上次读取末尾不完整的字符
+	buf    []byte
+}
+
+func (g *utf8Guard) Read(p []byte) (int, error) {
+	n, err := g.reader.Read(p)
+	g.buf = append(append(g.buf[:0], g.tail...), p[:n]...)
+	checked := g.buf
+	if err == nil {
+		checked = trimIncompleteUTF8(checked)
+	}
+	if i := invalidUTF8(checked); i >= 0 {
+		return 0, fmt.Errorf("%w: source guessed as UTF-8 from an ASCII prefix, but byte at offset %d is not valid UTF-8; specify the source encoding", ErrInvalidSequence, g.offset+int64(i))
+	}
+	g.offset += int64(len(checked))
+	g.tail = append(g.tail[:0], g.buf[len(checked):]...)
+	return n, err
+}
+
+// transcodeStream 将r从源编码分块转码为配置的目标编码写入w，返回读取和写入的字节数
+// 非法序列、无法表示的字符、换行符和规范化按配置处理并记录到log
+// file用于按扩展名改写字符集声明，流式转换时为空
+func transcodeStream(ctx context.Context, config *Config, r io.Reader, w io.Writer, from, file string, log *replacementLog) (int64, int64, error) {
+	counter := &countingReader{reader: &contextReader{ctx: ctx, reader: r}}
+	out := &countingWriter{writer: w}
+
+	transformer, err := newTranscoder(config, from, file, log)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	_, err = io.Copy(out, transform.NewReader(counter, transformer))
+	return counter.n, out.n, err
+}
+
+// sameEncoding 判断两个编码名称是否等价，无需转码
+func sameEncoding(a, b string) bool {
+	if isUTF8Name(a) && isUTF8Name(b) {
+		return true
+	}
+	return a == b
+}
+
+// contextReader 在每次读取前检查上下文
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// countingWriter 统计写入的字节数，并记录写入错误
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+	err    error
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.n += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,217 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gbkSampleText gbkSample对应的UTF-8文本
+const gbkSampleText = "这是一个测试文件，包含中文内容。"
+
+func TestConvertReader(t *testing.T) {
+	// 前置一个ASCII字节，使双字节字符跨越转码缓冲区边界
+	input := "x" + strings.Repeat(gbkSample, 1000)
+	expected := "x" + strings.Repeat(gbkSampleText, 1000)
+
+	t.Run("流式转换GBK", func(t *testing.T) {
+		var out bytes.Buffer
+		result, err := ConvertReader(context.Background(), strings.NewReader(input), &out)
+		if err != nil {
+			t.Fatalf("ConvertReader failed: %v", err)
+		}
+
+		if out.String() != expected {
+			t.Errorf("Output does not match expected UTF-8 text (got %d bytes, expected %d)", out.Len(), len(expected))
+		}
+		if result.BytesProcessed != int64(len(input)) {
+			t.Errorf("Expected BytesProcessed %d, got %d", len(input), result.BytesProcessed)
+		}
+		if result.OutputBytes != int64(len(expected)) {
+			t.Errorf("Expected OutputBytes %d, got %d", len(expected), result.OutputBytes)
+		}
+		if !result.Changed {
+			t.Error("Expected Changed to be true")
+		}
+	})
+
+	t.Run("UTF-8原样输出", func(t *testing.T) {
+		var out bytes.Buffer
+		result, err := ConvertReader(context.Background(), strings.NewReader(expected), &out)
+		if err != nil {
+			t.Fatalf("ConvertReader failed: %v", err)
+		}
+		if out.String() != expected {
+			t.Error("Expected UTF-8 input to be copied unchanged")
+		}
+		if result.Changed {
+			t.Error("Expected Changed to be false for UTF-8 input")
+		}
+	})
+
+	t.Run("低置信度不输出", func(t *testing.T) {
+		var out bytes.Buffer
+		_, err := ConvertReader(context.Background(), strings.NewReader(input), &out, WithMinConfidence(1.01))
+		if err == nil {
+			t.Fatal("Expected error for low confidence")
+		}
+		if out.Len() != 0 {
+			t.Errorf("Expected no output, got %d bytes", out.Len())
+		}
+	})
+
+	t.Run("取消", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := ConvertReader(ctx, strings.NewReader(input), &bytes.Buffer{})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestStreamThreshold(t *testing.T) {
+	input := "x" + strings.Repeat(gbkSample, 1000)
+	expected := "x" + strings.Repeat(gbkSampleText, 1000)
+
+	newFile := func(t *testing.T) string {
+		file := filepath.Join(t.TempDir(), "large.txt")
+		if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		return file
+	}
+
+	t.Run("大文件流式原地转换", func(t *testing.T) {
+		for _, atomic := range []bool{true, false} {
+			file := newFile(t)
+			result, err := ConvertFile(file, file,
+				WithOverwrite(true),
+				WithBackup(false),
+				WithStreamThreshold(1024),
+				WithAtomicWrite(atomic),
+			)
+			if err != nil {
+				t.Fatalf("ConvertFile failed (atomic=%v): %v", atomic, err)
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(data) != expected {
+				t.Errorf("Streamed output does not match expected text (atomic=%v)", atomic)
+			}
+			if result.BytesProcessed != int64(len(input)) {
+				t.Errorf("Expected BytesProcessed %d, got %d", len(input), result.BytesProcessed)
+			}
+			assertNoTempFiles(t, filepath.Dir(file))
+		}
+	})
+
+	t.Run("试运行统计输出大小", func(t *testing.T) {
+		file := newFile(t)
+		result, err := ConvertFile(file, file,
+			WithOverwrite(true),
+			WithStreamThreshold(1024),
+			WithDryRun(true),
+		)
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputBytes != int64(len(expected)) {
+			t.Errorf("Expected OutputBytes %d, got %d", len(expected), result.OutputBytes)
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(data) != input {
+			t.Error("Dry run should not modify the file")
+		}
+	})
+}
+
+func TestTrimIncompleteUTF8(t *testing.T) {
+	text := []byte("ab中")
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{"完整", text, "ab中"},
+		{"截断一字节", text[:4], "ab"},
+		{"截断两字节", text[:3], "ab"},
+		{"纯ASCII", []byte("abc"), "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(trimIncompleteUTF8(tt.input)); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestASCIIPrefix(t *testing.T) {
+	// 超过检测样本的ASCII开头（如日志头）之后才是GBK内容
+	header := strings.Repeat("2024-01-01 00:00:00 INFO service started\n", detectionSampleSize/40+10)
+	input := header + strings.Repeat(gbkSample+"\n", 200)
+	expected := header + strings.Repeat(gbkSampleText+"\n", 200)
+
+	newFile := func(t *testing.T) string {
+		file := filepath.Join(t.TempDir(), "app.log")
+		if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		return file
+	}
+
+	t.Run("整体读入时重新检测", func(t *testing.T) {
+		file := newFile(t)
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.ReplacementCount != 0 || isUTF8Name(result.SourceEncoding) {
+			t.Errorf("Expected GBK family without replacements, got %s with %d", result.SourceEncoding, result.ReplacementCount)
+		}
+		data, _ := os.ReadFile(file)
+		if string(data) != expected {
+			t.Error("Converted content does not match expected text")
+		}
+	})
+
+	t.Run("流式转换时报错且不改写", func(t *testing.T) {
+		for _, policy := range []ReplacementPolicy{ReplaceFail, ReplaceSubstitute} {
+			file := newFile(t)
+			_, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithStreamThreshold(1024), WithReplacementPolicy(policy))
+			if !errors.Is(err, ErrInvalidSequence) {
+				t.Errorf("Expected ErrInvalidSequence (%s), got %v", policy, err)
+			}
+			data, _ := os.ReadFile(file)
+			if string(data) != input {
+				t.Errorf("Expected file to be left unchanged (%s)", policy)
+			}
+			assertNoTempFiles(t, filepath.Dir(file))
+		}
+	})
+
+	t.Run("指定编码时流式转换", func(t *testing.T) {
+		file := newFile(t)
+		if _, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithStreamThreshold(1024), WithSourceEncoding("GBK")); err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		data, _ := os.ReadFile(file)
+		if string(data) != expected {
+			t.Error("Converted content does not match expected text")
+		}
+	})
+}
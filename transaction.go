@@ -0,0 +1,187 @@
+package convertcontent2utf8
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// stagingSuffix 事务暂存文件的后缀，暂存文件以点开头并写在目标文件旁
+const stagingSuffix = ".stage"
+
+// transaction 事务模式的暂存区：批量中的输出先写入暂存文件，全部成功后统一提交
+type transaction struct {
+	staged []*stagedOutput
+	mutex  sync.Mutex
+}
+
+// stagedOutput 一个已暂存、等待提交的输出
+type stagedOutput struct {
+	staged     string         // 暂存文件
+	held       string         // 提交时移开的原文件，回滚时放回
+	inputFile  string         // 输入文件
+	outputFile string         // 请求的输出路径，改名策略下与result.OutputFile不同
+	result     *ConvertResult // 转换结果，OutputFile为提交的目标
+	journal    *JournalEntry  // 待提交的撤销日志记录
+}
+
+// isStagingName 判断文件名是否为事务暂存文件，遍历目录时跳过
+func isStagingName(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, stagingSuffix)
+}
+
+// stage 把转换结果写入目标文件旁的暂存文件，不改动目标文件
+func (t *transaction) stage(ctx context.Context, config *Config, conv *conversion, meta *fileMetadata, inputFile, outputFile string) error {
+	result := conv.result
+	tmp, err := os.CreateTemp(filepath.Dir(result.OutputFile), "."+filepath.Base(result.OutputFile)+".*"+stagingSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create staging file: %w", err)
+	}
+	tmp.Close()
+
+	// 暂存文件经原子写入同步到磁盘，提交时只需重命名
+	stageConfig := *config
+	stageConfig.AtomicWrite = true
+	result.Metadata, err = writeOutput(ctx, &stageConfig, tmp.Name(), conv.write, conv.verifier(ctx, config, inputFile), meta)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if config.Verify {
+		result.Verification = VerifyPassed
+	}
+
+	t.mutex.Lock()
+	t.staged = append(t.staged, &stagedOutput{
+		staged:     tmp.Name(),
+		inputFile:  inputFile,
+		outputFile: outputFile,
+		result:     result,
+	})
+	t.mutex.Unlock()
+	return nil
+}
+
+// verify 提交前确认每个暂存文件完整
+func (t *transaction) verify() error {
+	for _, s := range t.staged {
+		info, err := os.Stat(s.staged)
+		if err != nil {
+			return fmt.Errorf("staged output for %s is missing: %w", s.result.OutputFile, err)
+		}
+		if info.Size() != s.result.OutputBytes {
+			return fmt.Errorf("staged output for %s has %d bytes, expected %d", s.result.OutputFile, info.Size(), s.result.OutputBytes)
+		}
+	}
+	return nil
+}
+
+// commit 校验全部暂存文件后依次替换目标文件；任一步失败时回滚已替换的文件并丢弃暂存区
+// 备份在替换时写入，撤销日志和清单在全部替换成功后由record写入，未提交的批量不留下任何记录
+func (t *transaction) commit(config *Config, env *fileEnv) (string, error) {
+	if err := t.verify(); err != nil {
+		t.discard()
+		return "", err
+	}
+
+	for i, s := range t.staged {
+		if err := t.commitOne(config, env, s); err != nil {
+			t.rollback(env, t.staged[:i+1])
+			t.discard()
+			return s.result.OutputFile, err
+		}
+	}
+
+	return "", nil
+}
+
+// record 提交成功后记录撤销日志和清单，并清理移开的原文件
+// 此时目标文件已全部替换，某个文件记录失败时继续处理其余文件，返回各文件的错误
+func (t *transaction) record(env *fileEnv) []FileError {
+	var fileErrors []FileError
+	for _, s := range t.staged {
+		if err := env.journal.commit(s.journal, s.result.OutputFile); err != nil {
+			fileErrors = append(fileErrors, newFileError(s.result.OutputFile, OpJournal, err))
+		}
+		if err := env.manifest.record(s.inputFile, s.outputFile, s.result); err != nil {
+			fileErrors = append(fileErrors, newFileError(s.inputFile, OpManifest, err))
+		}
+		if s.held != "" {
+			os.Remove(s.held)
+			s.held = ""
+		}
+	}
+	return fileErrors
+}
+
+// commitOne 备份并移开原文件，再把暂存文件重命名为目标文件
+func (t *transaction) commitOne(config *Config, env *fileEnv, s *stagedOutput) error {
+	target := s.result.OutputFile
+	overwritten := s.result.OutputAction == OutputOverwritten
+
+	if config.CreateBackup && overwritten {
+		backupFile, err := env.backups.backup(target)
+		if err != nil {
+			return err
+		}
+		s.result.BackupFile = backupFile
+	}
+
+	entry, err := env.journal.snapshot(target, s.result.OutputAction)
+	if err != nil {
+		return err
+	}
+	s.journal = entry
+
+	if overwritten {
+		tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.orig")
+		if err != nil {
+			return fmt.Errorf("failed to reserve holding file: %w", err)
+		}
+		tmp.Close()
+		held := tmp.Name()
+		if err := os.Rename(target, held); err != nil {
+			os.Remove(held)
+			return fmt.Errorf("failed to move original aside: %w", err)
+		}
+		s.held = held
+	}
+
+	if err := os.Rename(s.staged, target); err != nil {
+		return fmt.Errorf("failed to commit staged output: %w", err)
+	}
+	s.staged = ""
+	return syncDir(filepath.Dir(target))
+}
+
+// rollback 按相反顺序撤销已提交的文件，并删除撤销日志的原内容副本；备份保存的是原内容，予以保留
+func (t *transaction) rollback(env *fileEnv, committed []*stagedOutput) {
+	for i := len(committed) - 1; i >= 0; i-- {
+		s := committed[i]
+		target := s.result.OutputFile
+		if s.held != "" {
+			os.Rename(s.held, target)
+			s.held = ""
+		} else if s.staged == "" {
+			os.Remove(target)
+		}
+		env.journal.discard(s.journal)
+	}
+}
+
+// discard 删除全部暂存文件，改名策略预留的占位文件一并删除
+func (t *transaction) discard() {
+	for _, s := range t.staged {
+		if s.staged == "" {
+			continue
+		}
+		os.Remove(s.staged)
+		if s.result.OutputAction == OutputRenamed {
+			os.Remove(s.result.OutputFile)
+		}
+	}
+}
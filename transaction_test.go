@@ -0,0 +1,188 @@
+package convertcontent2utf8
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	setup := func(t *testing.T) (string, []string) {
+		testDir := t.TempDir()
+		var files []string
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			file := filepath.Join(testDir, name)
+			if err := os.WriteFile(file, []byte(gbkSample), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			files = append(files, file)
+		}
+		return testDir, files
+	}
+
+	assertContents := func(t *testing.T, files []string, expected string) {
+		t.Helper()
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(data) != expected {
+				t.Errorf("Unexpected content in %s: %q", filepath.Base(file), string(data))
+			}
+		}
+	}
+
+	assertNoStaging := func(t *testing.T, dir string) {
+		t.Helper()
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("Failed to read directory: %v", err)
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") {
+				t.Errorf("Staging file left behind: %s", entry.Name())
+			}
+		}
+	}
+
+	t.Run("全部成功时提交", func(t *testing.T) {
+		testDir, files := setup(t)
+
+		result, err := ConvertFiles(files, WithOverwrite(true), WithBackup(false), WithTransaction(true))
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if !result.Committed {
+			t.Error("Expected Committed to be true")
+		}
+		if result.SuccessfulFiles != len(files) {
+			t.Errorf("Expected SuccessfulFiles %d, got %d", len(files), result.SuccessfulFiles)
+		}
+		assertContents(t, files, gbkSampleText)
+		assertNoStaging(t, testDir)
+	})
+
+	t.Run("任一文件失败时不改动任何文件", func(t *testing.T) {
+		testDir, files := setup(t)
+		missing := filepath.Join(testDir, "missing.txt")
+
+		result, err := ConvertFiles(append(files, missing), WithOverwrite(true), WithBackup(false), WithTransaction(true))
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if result.Committed {
+			t.Error("Expected Committed to be false")
+		}
+		if result.FailedFiles != 1 {
+			t.Errorf("Expected FailedFiles 1, got %d", result.FailedFiles)
+		}
+		assertContents(t, files, gbkSample)
+		assertNoStaging(t, testDir)
+	})
+
+	t.Run("遍历目录失败时不提交", func(t *testing.T) {
+		testDir, files := setup(t)
+		converter := NewConverter(WithOverwrite(true), WithBackup(false), WithTransaction(true))
+
+		run, err := converter.newBatchRun(len(files), testDir)
+		if err != nil {
+			t.Fatalf("newBatchRun failed: %v", err)
+		}
+		// 模拟遍历中途某个子目录无法读取，已发现的文件都转换成功
+		run.walkErr = errors.New("permission denied")
+		paths := make(chan string, len(files))
+		for _, file := range files {
+			paths <- file
+		}
+		close(paths)
+
+		result, err := converter.runBatch(context.Background(), run, paths)
+		if err != nil {
+			t.Fatalf("runBatch failed: %v", err)
+		}
+		if result.Committed {
+			t.Error("Expected Committed to be false")
+		}
+		assertContents(t, files, gbkSample)
+		assertNoStaging(t, testDir)
+	})
+
+	t.Run("提交时写入备份和撤销日志", func(t *testing.T) {
+		testDir, files := setup(t)
+		journalPath := filepath.Join(t.TempDir(), "undo.journal")
+
+		result, err := ConvertFiles(files, WithOverwrite(true), WithBackup(true), WithTransaction(true), WithJournal(journalPath))
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if !result.Committed {
+			t.Fatal("Expected Committed to be true")
+		}
+		for _, r := range result.Results {
+			if r.BackupFile == "" {
+				t.Errorf("Expected backup for %s", r.InputFile)
+			}
+		}
+
+		undo, err := Undo(journalPath)
+		if err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+		if len(undo.Restored) != len(files) {
+			t.Errorf("Expected %d restored files, got %d", len(files), len(undo.Restored))
+		}
+		assertContents(t, files, gbkSample)
+		assertNoStaging(t, testDir)
+	})
+
+	t.Run("试运行不暂存", func(t *testing.T) {
+		testDir, files := setup(t)
+
+		result, err := ConvertFiles(files, WithOverwrite(true), WithDryRun(true), WithTransaction(true))
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if result.Committed {
+			t.Error("Dry run should not commit")
+		}
+		assertContents(t, files, gbkSample)
+		assertNoStaging(t, testDir)
+	})
+
+	t.Run("提交后记录失败时继续清理", func(t *testing.T) {
+		testDir, files := setup(t)
+		manifest, err := LoadManifest(filepath.Join(testDir, "manifest.json"))
+		if err != nil {
+			t.Fatalf("LoadManifest failed: %v", err)
+		}
+
+		// 第一个文件的输入已不存在，记录清单失败；第二个文件正常
+		var staged []*stagedOutput
+		for i, input := range []string{filepath.Join(testDir, "missing.txt"), files[1]} {
+			held := filepath.Join(testDir, "."+filepath.Base(files[i])+".1.orig")
+			if err := os.WriteFile(held, []byte(gbkSample), 0644); err != nil {
+				t.Fatalf("Failed to create holding file: %v", err)
+			}
+			staged = append(staged, &stagedOutput{
+				held:       held,
+				inputFile:  input,
+				outputFile: input,
+				result:     &ConvertResult{OutputFile: files[i], OutputAction: OutputOverwritten},
+			})
+		}
+
+		txn := &transaction{staged: staged}
+		fileErrors := txn.record(&fileEnv{manifest: manifest})
+		if len(fileErrors) != 1 || fileErrors[0].Operation != OpManifest {
+			t.Errorf("Expected 1 manifest error, got %+v", fileErrors)
+		}
+		if len(manifest.Entries()) != 1 {
+			t.Errorf("Expected the second file to be recorded, got %d entries", len(manifest.Entries()))
+		}
+		assertNoStaging(t, testDir)
+	})
+}
@@ -15,6 +15,51 @@ const (
 	StatusCompleted  ProgressStatus = "completed"
 	StatusFailed     ProgressStatus = "failed"
 	StatusSkipped    ProgressStatus = "skipped"
+
+	StatusLowConfidence ProgressStatus = "low_confidence" // 检测置信度低于阈值，已跳过
+	StatusBinary        ProgressStatus = "binary"         // 内容为二进制，已跳过
+	StatusUnchanged     ProgressStatus = "unchanged"      // 已是目标编码，无需转换，未改写
+	StatusUpToDate      ProgressStatus = "up_to_date"     // 增量模式下自上次成功处理后未变化，已跳过
+)
+
+// BackupMode 备份位置模式
+type BackupMode string
+
+const (
+	BackupSibling BackupMode = "sibling" // 与原文件同目录，文件名追加备份后缀
+	BackupMirror  BackupMode = "mirror"  // 在备份目录中镜像原目录结构
+	BackupArchive BackupMode = "archive" // 在备份目录下按运行时间戳归档
+)
+
+// ExistingPolicy 输出文件已存在时的处理策略
+type ExistingPolicy string
+
+const (
+	ExistingFail      ExistingPolicy = "fail"      // 报错，不改动已有文件
+	ExistingSkip      ExistingPolicy = "skip"      // 跳过该文件
+	ExistingOverwrite ExistingPolicy = "overwrite" // 覆盖已有文件
+	ExistingRename    ExistingPolicy = "rename"    // 写入带数字后缀的新文件
+)
+
+// OutputAction 对输出文件实际采取的处理
+type OutputAction string
+
+const (
+	OutputCreated     OutputAction = "created"     // 输出文件原本不存在
+	OutputOverwritten OutputAction = "overwritten" // 覆盖了已有文件
+	OutputSkipped     OutputAction = "skipped"     // 因已有文件而跳过
+	OutputRenamed     OutputAction = "renamed"     // 写入了唯一命名的新文件
+	OutputUnchanged   OutputAction = "unchanged"   // 已是目标编码，无需转换，未写入
+	OutputUpToDate    OutputAction = "up_to_date"  // 清单显示自上次成功处理后未变化，未处理
+)
+
+// UnchangedCheck 原地转换为UTF-8前判断文件无需转换的方式
+type UnchangedCheck string
+
+const (
+	CheckValidUTF8 UnchangedCheck = "utf8"  // 合法UTF-8文件不改写
+	CheckASCII     UnchangedCheck = "ascii" // 仅纯ASCII文件不改写
+	CheckNone      UnchangedCheck = "none"  // 不预检，总是检测并转换
 )
 
 // Progress 进度信息结构
@@ -23,6 +68,7 @@ type Progress struct {
 	CurrentFile    string         `json:"current_file"`
 	ProcessedFiles int            `json:"processed_files"`
 	TotalFiles     int            `json:"total_files"`
+	Discovering    bool           `json:"discovering,omitempty"` // 目录仍在遍历中，TotalFiles为目前已发现的文件数
 	Status         ProgressStatus `json:"status"`
 
 	// 时间信息
@@ -43,10 +89,33 @@ type ConvertResult struct {
 	SourceEncoding      string                      `json:"source_encoding"`
 	TargetEncoding      string                      `json:"target_encoding"`
 	BytesProcessed      int64                       `json:"bytes_processed"`
+	OutputBytes         int64                       `json:"output_bytes"`
+	Changed             bool                        `json:"changed"` // 输出内容是否与现有文件不同
+	DryRun              bool                        `json:"dry_run,omitempty"`
 	ProcessingTime      time.Duration               `json:"processing_time"`
 	DetectionConfidence float64                     `json:"detection_confidence"`
 	BackupFile          string                      `json:"backup_file,omitempty"`
-	ProcessorResult     *encoding.FileProcessResult `json:"-"` // 底层库结果
+	OutputAction        OutputAction                `json:"output_action"`
+	Metadata            *MetadataResult             `json:"metadata,omitempty"`          // 元数据保留结果
+	Verification        VerifyStatus                `json:"verification,omitempty"`      // 往返校验状态，未启用校验时为空
+	ReplacementCount    int                         `json:"replacement_count,omitempty"` // 被替换的非法序列和无法表示的字符数量
+	Replacements        []Replacement               `json:"replacements,omitempty"`      // 替换位置，最多列出前1000处
+	InputBOM            BOM                         `json:"input_bom,omitempty"`         // 输入开头的BOM，没有时为空
+	OutputBOM           BOM                         `json:"output_bom,omitempty"`        // 输出开头的BOM，没有时为空
+	LineEndings         LineEndingCounts            `json:"line_endings"`                // 输入中各种换行符的数量
+	NormalizedCount     int                         `json:"normalized_count,omitempty"`  // Unicode规范化后发生变化的字符数，按组合字符序列计
+	DeclaredEncoding    string                      `json:"declared_encoding,omitempty"` // 文件内字符集声明的名称（如"gbk"），没有声明时为空
+	DeclarationCount    int                         `json:"declaration_count,omitempty"` // 改为目标编码的字符集声明数量
+	ProcessorResult     *encoding.FileProcessResult `json:"-"`                           // 底层库结果
+}
+
+// MetadataResult 文件元数据保留结果
+type MetadataResult struct {
+	Mode   bool     `json:"mode"`
+	Times  bool     `json:"times"`
+	Owner  bool     `json:"owner"`
+	Xattrs bool     `json:"xattrs"`
+	Errors []string `json:"errors,omitempty"` // 未能保留的项目及原因
 }
 
 // BatchResult 批量转换结果
@@ -56,10 +125,13 @@ type BatchResult struct {
 	SuccessfulFiles int              `json:"successful_files"`
 	FailedFiles     int              `json:"failed_files"`
 	SkippedFiles    int              `json:"skipped_files"`
+	UnchangedFiles  int              `json:"unchanged_files"` // 已是目标编码的文件，同时计入SuccessfulFiles
 	TotalBytes      int64            `json:"total_bytes"`
 	ProcessingTime  time.Duration    `json:"processing_time"`
 	Results         []*ConvertResult `json:"results"`
 	Errors          []FileError      `json:"errors,omitempty"`
+	Cancelled       bool             `json:"cancelled,omitempty"` // 因上下文取消而提前结束，结果不完整
+	Committed       bool             `json:"committed,omitempty"` // 事务模式下为true表示全部输出已提交，为false表示未改动任何文件
 }
 
 // FileError 文件处理错误
@@ -67,6 +139,7 @@ type FileError struct {
 	File      string    `json:"file"`
 	Operation string    `json:"operation"`
 	Error     string    `json:"error"`
+	Err       error     `json:"-"` // *ConvertError，可用errors.Is/As判断
 	Timestamp time.Time `json:"timestamp"`
 }
 
@@ -78,6 +151,9 @@ type Config struct {
 	// 进度回调函数
 	ProgressCallback func(Progress)
 
+	// 批量结果回调，设置后每个成功的结果交给回调，不再保存在BatchResult.Results中
+	ResultCallback func(*ConvertResult)
+
 	// 并发限制，默认为4
 	ConcurrencyLimit int
 
@@ -87,13 +163,71 @@ type Config struct {
 	// encoding-processor选项
 	CreateBackup      bool
 	OverwriteExisting bool
+	ExistingPolicy    ExistingPolicy // 输出文件已存在时的策略，为空时由OverwriteExisting决定
 	MinConfidence     float64
 	DryRun            bool
 
+	// 备份选项
+	BackupMode   BackupMode // 备份位置模式，默认与原文件同目录
+	BackupDir    string     // 备份目录，镜像和归档模式下必填
+	BackupSuffix string     // 备份文件后缀，默认".bak"
+
+	// 源编码：SourceEncoding强制使用、跳过检测；EncodingHint作为检测的优先候选；EncodingRules按路径指定，优先于前两者
+	SourceEncoding string
+	EncodingHint   string
+	EncodingRules  []EncodingRule
+
+	// 强制处理内容像二进制的文件，默认跳过
+	IncludeBinary bool
+
+	// 原地转换为UTF-8时，预检通过的文件不改写，默认合法UTF-8即通过
+	UnchangedCheck UnchangedCheck
+
+	// 增量模式的清单文件路径，为空时不启用
+	ManifestPath string
+
+	// 撤销日志路径，为空时不记录；原内容副本保存在同名".data"目录中
+	JournalPath string
+
+	// 非法字节序列和目标编码无法表示的字符的处理策略，默认替换
+	ReplacementPolicy ReplacementPolicy
+
+	// 换行符处理方式，默认保持原样
+	LineEnding LineEnding
+
+	// 转码后的Unicode规范化，默认不规范化
+	Normalization Normalization
+
+	// BOM策略，默认保留输入的BOM
+	BOMPolicy     BOMPolicy
+	BOMExtensions []string // BOMAddByExtension策略下带BOM的扩展名，如"csv"
+
+	// 识别HTML、XML、CSS和Python文件开头的字符集声明，作为检测的提示并改为目标编码，默认启用
+	CharsetDeclarations bool
+
+	// 写入后做往返校验，未通过的文件计为失败并放弃写入
+	Verify bool
+
+	// 事务模式：批量输出先暂存，全部文件成功后才统一提交，否则不改动任何文件
+	Transactional bool
+
+	// 单个文件的处理超时，0表示不限制
+	FileTimeout time.Duration
+
+	// 写入选项
+	AtomicWrite    bool // 通过临时文件+fsync+重命名原子写入，默认开启
+	PreserveMode   bool // 保留源文件权限，默认开启
+	PreserveTimes  bool // 保留源文件访问和修改时间
+	PreserveOwner  bool // 保留属主和属组（需要相应权限）
+	PreserveXattrs bool // 保留扩展属性（仅Linux）
+
+	// 超过该大小的文件流式转换，不整体读入内存，0表示总是整体读入
+	StreamThreshold int64
+
 	// 其他选项
 	SkipHidden  bool  // 跳过隐藏文件
 	Recursive   bool  // 目录递归处理
-	MaxFileSize int64 // 最大文件大小限制
+	MaxFileSize int64 // 最大文件大小限制，0表示不限制
 }
 
 // Option 配置选项函数类型
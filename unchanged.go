@@ -0,0 +1,151 @@
+package convertcontent2utf8
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	encoding "github.com/mirbf/encoding-processor"
+	"golang.org/x/text/transform"
+)
+
+// unchangedScanSize 预检时每次读取的字节数
+const unchangedScanSize = 64 * 1024
+
+// checksUnchanged 判断本次转换是否需要预检：只有原地转换为UTF-8时文件才可能无需改写
+func (c *Config) checksUnchanged(inputFile, outputFile string) bool {
+	return c.UnchangedCheck != CheckNone && isUTF8Name(c.TargetEncoding) && sameFile(inputFile, outputFile)
+}
+
+// unchangedResult 预检文件，已是目标编码且BOM、换行符、规范化和字符集声明符合设置时返回无需转换的结果，否则返回nil
+func unchangedResult(config *Config, inputFile, outputFile string) (*ConvertResult, error) {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// 强制按非UTF-8编码读取时：UTF-16/32文件总要改写，其他编码只有纯ASCII的文件才无需改写
+	asciiOnly := config.UnchangedCheck == CheckASCII
+	if hint, force := config.sourceHint(inputFile); force && !isUTF8Name(hint) {
+		if newNewlineNormalizer(hint).width > 1 {
+			return nil, nil
+		}
+		asciiOnly = true
+	}
+
+	start := time.Now()
+	head := make([]byte, maxBOMLen+declarationScanSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	counter := &lineEndingCounter{reader: io.MultiReader(bytes.NewReader(head), file)}
+	var source io.Reader = counter
+
+	// 需要规范化时同时检查是否已是规范形式；设置无效时交给转换流程报错
+	form, normalize, err := config.normalizationForm()
+	if err != nil {
+		return nil, nil
+	}
+	log := &replacementLog{}
+	var normalized *transform.Writer
+	if normalize {
+		normalized = transform.NewWriter(io.Discard, &normalizer{form: form, log: log})
+		source = io.TeeReader(counter, normalized)
+	}
+
+	ok, size, err := scanUnchanged(source, asciiOnly)
+	if err != nil || !ok {
+		return nil, err
+	}
+	endings := counter.finish()
+	if normalized != nil {
+		if err := normalized.Close(); err != nil || log.normalized > 0 {
+			return nil, nil
+		}
+	}
+
+	// 需要添加或去掉BOM、统一换行符或改写字符集声明时仍要改写
+	bom := sniffBOM(head)
+	if want, err := config.outputBOM(outputFile, bom); err != nil || want != bom {
+		return nil, nil
+	}
+	if newline, err := newlineFor(config.LineEnding); err != nil || !endings.conforms(newline) {
+		return nil, nil
+	}
+	var declared string
+	if format := formatFor(inputFile); config.CharsetDeclarations && format != formatNone {
+		body := head[len(bom.Bytes()):]
+		if _, edits := rewriteDeclarations(format, body, config.TargetEncoding); len(edits) > 0 {
+			return nil, nil
+		}
+		declared = declaredEncoding(format, body)
+	}
+
+	return &ConvertResult{
+		InputFile:           inputFile,
+		OutputFile:          outputFile,
+		SourceEncoding:      encoding.EncodingUTF8,
+		TargetEncoding:      config.TargetEncoding,
+		BytesProcessed:      size,
+		OutputBytes:         size,
+		Changed:             false,
+		DryRun:              config.DryRun,
+		ProcessingTime:      time.Since(start),
+		DetectionConfidence: 1.0,
+		OutputAction:        OutputUnchanged,
+		InputBOM:            bom,
+		OutputBOM:           bom,
+		LineEndings:         endings,
+		DeclaredEncoding:    declared,
+	}, nil
+}
+
+// scanUnchanged 分块检查r是否为合法UTF-8（asciiOnly时要求纯ASCII），遇到第一个不符合的字节即停止
+// 块边界处不完整的多字节序列留到下一块一起检查，返回已读取的字节数
+func scanUnchanged(r io.Reader, asciiOnly bool) (bool, int64, error) {
+	buf := make([]byte, unchangedScanSize)
+	var total int64
+	carry := 0
+
+	for {
+		n, err := r.Read(buf[carry:])
+		total += int64(n)
+		data := buf[:carry+n]
+
+		if err == io.EOF {
+			return validText(data, asciiOnly), total, nil
+		}
+
+		complete := data
+		if !asciiOnly {
+			complete = trimIncompleteUTF8(data)
+		}
+		if !validText(complete, asciiOnly) {
+			return false, total, nil
+		}
+		carry = copy(buf, data[len(complete):])
+
+		if err != nil {
+			return false, total, err
+		}
+	}
+}
+
+// validText 检查数据是否为合法UTF-8或纯ASCII
+func validText(data []byte, asciiOnly bool) bool {
+	if !asciiOnly {
+		return utf8.Valid(data)
+	}
+	for _, b := range data {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package convertcontent2utf8
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestUnchanged(t *testing.T) {
+	past := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	newFile := func(t *testing.T, content string) string {
+		file := filepath.Join(t.TempDir(), "test.txt")
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if err := os.Chtimes(file, past, past); err != nil {
+			t.Fatalf("Failed to set file times: %v", err)
+		}
+		return file
+	}
+
+	modified := func(t *testing.T, file string) bool {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Failed to stat file: %v", err)
+		}
+		return !info.ModTime().Equal(past)
+	}
+
+	t.Run("UTF-8文件不改写", func(t *testing.T) {
+		file := newFile(t, gbkSampleText)
+		var statuses []ProgressStatus
+		result, err := ConvertFile(file, file, WithProgress(func(p Progress) {
+			statuses = append(statuses, p.Status)
+		}))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+
+		if result.OutputAction != OutputUnchanged {
+			t.Errorf("Expected OutputAction %s, got %s", OutputUnchanged, result.OutputAction)
+		}
+		if result.Changed {
+			t.Error("Expected Changed to be false")
+		}
+		if result.BackupFile != "" {
+			t.Errorf("Expected no backup, got %s", result.BackupFile)
+		}
+		if modified(t, file) {
+			t.Error("Unchanged file should not be rewritten")
+		}
+		if last := statuses[len(statuses)-1]; last != StatusUnchanged {
+			t.Errorf("Expected final status %s, got %s", StatusUnchanged, last)
+		}
+	})
+
+	t.Run("仅ASCII模式", func(t *testing.T) {
+		file := newFile(t, gbkSampleText)
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithUnchangedCheck(CheckASCII))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction == OutputUnchanged {
+			t.Error("Expected non-ASCII file to go through conversion")
+		}
+
+		file = newFile(t, "plain ascii")
+		result, err = ConvertFile(file, file, WithUnchangedCheck(CheckASCII))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputUnchanged {
+			t.Errorf("Expected OutputAction %s, got %s", OutputUnchanged, result.OutputAction)
+		}
+	})
+
+	t.Run("关闭预检", func(t *testing.T) {
+		file := newFile(t, gbkSampleText)
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithUnchangedCheck(CheckNone))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.OutputAction != OutputOverwritten {
+			t.Errorf("Expected OutputAction %s, got %s", OutputOverwritten, result.OutputAction)
+		}
+		if !modified(t, file) {
+			t.Error("Expected file to be rewritten")
+		}
+	})
+
+	t.Run("批量统计", func(t *testing.T) {
+		utf8File := newFile(t, gbkSampleText)
+		gbkFile := newFile(t, gbkSample)
+
+		result, err := ConvertFiles([]string{utf8File, gbkFile}, WithOverwrite(true), WithBackup(false))
+		if err != nil {
+			t.Fatalf("ConvertFiles failed: %v", err)
+		}
+		if result.UnchangedFiles != 1 {
+			t.Errorf("Expected UnchangedFiles 1, got %d", result.UnchangedFiles)
+		}
+		if result.SuccessfulFiles != 2 {
+			t.Errorf("Expected SuccessfulFiles 2, got %d", result.SuccessfulFiles)
+		}
+		if !modified(t, gbkFile) {
+			t.Error("Expected GBK file to be converted")
+		}
+	})
+}
+
+func TestScanUnchanged(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		asciiOnly bool
+		expected  bool
+	}{
+		{"UTF-8", gbkSampleText, false, true},
+		{"GBK", gbkSample, false, false},
+		{"截断的UTF-8", gbkSampleText[:len(gbkSampleText)-1], false, false},
+		{"ASCII", "hello", true, true},
+		{"非ASCII", gbkSampleText, true, false},
+		{"空内容", "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 逐字节读取，使多字节序列跨越读取边界
+			got, _, err := scanUnchanged(iotest.OneByteReader(strings.NewReader(tt.input)), tt.asciiOnly)
+			if err != nil {
+				t.Fatalf("scanUnchanged failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package convertcontent2utf8
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/text/transform"
+)
+
+// VerifyStatus 往返校验状态
+type VerifyStatus string
+
+const (
+	VerifyPassed  VerifyStatus = "passed"  // 输出为合法的目标编码，且转回源编码与原文件逐字节一致
+	VerifySkipped VerifyStatus = "skipped" // 未写入输出（已是目标编码、跳过或试运行），无需校验
+)
+
+// verifier 返回写入后对输出文件做往返校验的检查函数，未启用校验时返回nil
+// 检查在原子写入重命名之前对临时文件进行，失败时放弃写入，目标文件保持原样
+func (c *conversion) verifier(ctx context.Context, config *Config, inputFile string) func(name string) error {
+	if !config.Verify {
+		return nil
+	}
+	return func(name string) error {
+		err := verifyRoundTrip(ctx, config, inputFile, name, c.result.SourceEncoding)
+		if err != nil {
+			c.verifyFailed = true
+		}
+		return err
+	}
+}
+
+// withVerification 启用校验时，为未写入输出的结果标记无需校验
+func withVerification(config *Config, result *ConvertResult) *ConvertResult {
+	if config.Verify && result.Verification == "" {
+		result.Verification = VerifySkipped
+	}
+	return result
+}
+
+// verifyRoundTrip 检查输出文件能按目标编码解码，且转回源编码后与输入文件逐字节一致
+// 两边开头的BOM按策略单独处理，不参与比较；改写的字符集声明按改写后的内容比较；统一换行符时两边都把换行统一为LF后再比较
+// 规范化会有意改变字符，此时改为检查输出与输入严格解码并规范化后的内容一致
+func verifyRoundTrip(ctx context.Context, config *Config, inputFile, outputFile, sourceEncoding string) error {
+	targetEncoding := config.TargetEncoding
+
+	// 目标编码为UTF-8时先严格检查合法性
+	if isUTF8Name(targetEncoding) {
+		f, err := os.Open(outputFile)
+		if err != nil {
+			return err
+		}
+		valid, n, err := scanUnchanged(&contextReader{ctx: ctx, reader: f}, false)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return fmt.Errorf("%w: output is not valid UTF-8 near byte %d", ErrVerificationFailed, n)
+		}
+	}
+
+	output, err := os.Open(outputFile)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	// 比较的两边和比较所用的编码；输入中的字符集声明按转换时的方式改写
+	roundTrip, original := skipBOM(output), skipBOM(input)
+	log := &replacementLog{}
+	if rewriter := config.declarationRewriter(inputFile, sourceEncoding, log); rewriter != nil {
+		original = transform.NewReader(original, rewriter)
+	}
+	compared := sourceEncoding
+	if form, ok, _ := config.normalizationForm(); ok {
+		decoder, err := newReplacingTranscoder(sourceEncoding, targetEncoding, ReplaceFail, LineEndingKeep, log)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrVerificationFailed, err)
+		}
+		original = transform.NewReader(original, transform.Chain(decoder, &normalizer{form: form, log: &replacementLog{}}))
+		compared = targetEncoding
+	} else {
+		roundTrip, err = reverseReader(roundTrip, sourceEncoding, targetEncoding)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrVerificationFailed, err)
+		}
+	}
+
+	if newline, _ := newlineFor(config.LineEnding); newline != "" {
+		roundTrip = transform.NewReader(roundTrip, newNewlineNormalizer(compared))
+		original = transform.NewReader(original, newNewlineNormalizer(compared))
+	}
+
+	offset, err := compareReaders(&contextReader{ctx: ctx, reader: roundTrip}, original)
+	if err != nil {
+		return fmt.Errorf("%w: cannot compare output with the original in %s: %w", ErrVerificationFailed, compared, err)
+	}
+	if offset >= 0 {
+		return fmt.Errorf("%w: round trip to %s differs from the original at byte %d", ErrVerificationFailed, compared, offset)
+	}
+	return nil
+}
+
+// reverseReader 把目标编码的输出转回源编码，源编码不支持的字符报错而不是替换
+func reverseReader(r io.Reader, sourceEncoding, targetEncoding string) (io.Reader, error) {
+	if sameEncoding(sourceEncoding, targetEncoding) {
+		return r, nil
+	}
+
+	var chain []transform.Transformer
+	if !isUTF8Name(targetEncoding) {
+		dst, err := lookupEncoding(targetEncoding)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, dst.NewDecoder())
+	}
+	if !isUTF8Name(sourceEncoding) {
+		src, err := lookupEncoding(sourceEncoding)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, src.NewEncoder())
+	}
+	return transform.NewReader(r, transform.Chain(chain...)), nil
+}
+
+// skipBOM 跳过r开头的BOM
+func skipBOM(r io.Reader) io.Reader {
+	br := bufio.NewReaderSize(r, unchangedScanSize)
+	head, _ := br.Peek(maxBOMLen)
+	br.Discard(len(sniffBOM(head).Bytes()))
+	return br
+}
+
+// compareReaders 逐字节比较两个输入，返回第一个不同字节的偏移，完全相同时返回-1
+func compareReaders(a, b io.Reader) (int64, error) {
+	ra := bufio.NewReaderSize(a, unchangedScanSize)
+	rb := bufio.NewReaderSize(b, unchangedScanSize)
+
+	var offset int64
+	for {
+		ca, errA := ra.ReadByte()
+		cb, errB := rb.ReadByte()
+		if errA != nil && errA != io.EOF {
+			return 0, errA
+		}
+		if errB != nil && errB != io.EOF {
+			return 0, errB
+		}
+		if errA == io.EOF || errB == io.EOF {
+			if errA == errB {
+				return -1, nil
+			}
+			return offset, nil
+		}
+		if ca != cb {
+			return offset, nil
+		}
+		offset++
+	}
+}
@@ -0,0 +1,115 @@
+package convertcontent2utf8
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	t.Run("校验通过", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "data.txt")
+		if err := os.WriteFile(file, []byte(gbkSample), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithBackup(false), WithVerify(true))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.Verification != VerifyPassed {
+			t.Errorf("Expected verification %q, got %q", VerifyPassed, result.Verification)
+		}
+	})
+
+	t.Run("无需写入时标记跳过", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "data.txt")
+		if err := os.WriteFile(file, []byte(gbkSampleText), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		result, err := ConvertFile(file, file, WithOverwrite(true), WithVerify(true))
+		if err != nil {
+			t.Fatalf("ConvertFile failed: %v", err)
+		}
+		if result.Verification != VerifySkipped {
+			t.Errorf("Expected verification %q, got %q", VerifySkipped, result.Verification)
+		}
+	})
+
+	t.Run("有损转换计为失败并放弃写入", func(t *testing.T) {
+		// 0x81 0x20不是合法的GBK双字节序列，转换时会被替换
+		original := strings.Repeat(gbkSample, 20) + "\x81\x20" + strings.Repeat(gbkSample, 20)
+		for _, atomic := range []bool{true, false} {
+			file := filepath.Join(t.TempDir(), "lossy.txt")
+			if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			result, err := ConvertFiles([]string{file},
+				WithOverwrite(true),
+				WithBackup(false),
+				WithMinConfidence(0),
+				WithAtomicWrite(atomic),
+				WithVerify(true),
+				WithReplacementPolicy(ReplaceSubstitute),
+			)
+			if err != nil {
+				t.Fatalf("ConvertFiles failed: %v", err)
+			}
+			if result.FailedFiles != 1 {
+				t.Fatalf("Expected FailedFiles 1 (atomic=%v), got %d", atomic, result.FailedFiles)
+			}
+			if result.Errors[0].Operation != "verify" {
+				t.Errorf("Expected operation verify, got %s", result.Errors[0].Operation)
+			}
+
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(data) != original {
+				t.Errorf("Expected original content to be kept (atomic=%v)", atomic)
+			}
+			assertNoTempFiles(t, filepath.Dir(file))
+		}
+	})
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	testDir := t.TempDir()
+	input := filepath.Join(testDir, "input.txt")
+	if err := os.WriteFile(input, []byte(gbkSample), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		valid  bool
+	}{
+		{"一致", gbkSampleText, true},
+		{"内容不同", strings.Replace(gbkSampleText, "中文", "英文", 1), false},
+		{"内容截断", gbkSampleText[:len(gbkSampleText)-3], false},
+		{"非法UTF-8", gbkSampleText + "\xff", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(testDir, "output.txt")
+			if err := os.WriteFile(output, []byte(tt.output), 0644); err != nil {
+				t.Fatalf("Failed to create output file: %v", err)
+			}
+
+			err := verifyRoundTrip(context.Background(), getDefaultConfig(), input, output, "GBK")
+			if tt.valid && err != nil {
+				t.Errorf("Expected verification to pass, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected verification to fail")
+			}
+		})
+	}
+}